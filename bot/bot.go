@@ -0,0 +1,359 @@
+// Package bot runs the AOE4 Elo bot, so that it can be embedded in another program.
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/config"
+	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/db"
+	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/discordapi"
+	"github.com/bwmarrin/discordgo"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/robfig/cron/v3"
+)
+
+// Config holds the bot configuration, as read from the config file.
+type Config = config.ConfigFile
+
+const (
+	// configPollInterval is how often the config file is checked for changes.
+	configPollInterval = 10 * time.Second
+	// leaderElectionInterval is how often leadership of the local shards is checked and, for shards
+	// without a leader, claimed. It bounds how long scheduled work goes without a leader after one dies.
+	leaderElectionInterval = 15 * time.Second
+	// shardIdentifyInterval is the delay between connecting shards, as Discord allows one identify every 5 seconds.
+	shardIdentifyInterval = 5 * time.Second
+)
+
+// activeBot holds the Bot that was created and not yet closed, as it sets the config and database pool
+// used by the whole process.
+var activeBot struct {
+	bot *Bot
+	sync.Mutex
+}
+
+// LoadConfig reads the config file at path.
+func LoadConfig(path string) (*Config, error) {
+	return config.Load(path)
+}
+
+// Options configures a Bot.
+type Options struct {
+	// Config is the bot configuration. It is required.
+	Config *Config
+	// DB is the database connection pool. If nil, a pool is opened from Config.DbUrl and closed by Close.
+	DB *pgxpool.Pool
+	// Session is the Discord session. If nil, a session is created from Config.BotToken for each local shard
+	// of Config and closed by Close.
+	Session *discordgo.Session
+	// ReloadConfig enables reloading the config file when it is modified or the process receives SIGHUP.
+	// It requires Config to have been read with LoadConfig.
+	ReloadConfig bool
+}
+
+// A Bot tracks the Elo of registered Discord members and assigns their Elo roles.
+// Only one Bot can be used in a process at a time, so a Bot must be closed before another is created.
+type Bot struct {
+	opts Options
+	// sessions holds Options.Session, or the sessions created for each local shard.
+	sessions []*discordgo.Session
+	// leading holds the map[int]bool of the IDs of the local shards whose scheduled work is run by b.
+	leading     atomic.Value
+	ownsDB      bool
+	ownsSession bool
+}
+
+// New creates a Bot from opts, connecting to the database if needed and applying any pending migrations.
+// It returns an error if the config has errors, or if another Bot was created and not closed.
+func New(ctx context.Context, opts Options) (*Bot, error) {
+	if opts.Config == nil {
+		return nil, errors.New("no config given")
+	}
+	if problems := opts.Config.Validate(); config.HasErrors(problems) {
+		msgs := make([]string, len(problems))
+		for i, problem := range problems {
+			msgs[i] = problem.String()
+		}
+		return nil, errors.New("config is invalid: " + strings.Join(msgs, "; "))
+	}
+
+	b := &Bot{opts: opts}
+	activeBot.Lock()
+	if activeBot.bot != nil {
+		activeBot.Unlock()
+		return nil, errors.New("another Bot is in use in this process, close it first")
+	}
+	activeBot.bot = b
+	activeBot.Unlock()
+
+	config.Set(opts.Config)
+	if b.opts.DB == nil {
+		pool, err := db.Connect(ctx, opts.Config.DbUrl)
+		if err != nil {
+			b.Close() //nolint:errcheck
+			return nil, err
+		}
+		b.opts.DB = pool
+		b.ownsDB = true
+	}
+	db.Db = b.opts.DB
+
+	if err := db.Migrate(ctx); err != nil {
+		b.Close() //nolint:errcheck
+		return nil, fmt.Errorf("error setting up database: %w", err)
+	}
+
+	if b.opts.Session != nil {
+		b.sessions = []*discordgo.Session{b.opts.Session}
+	} else {
+		b.ownsSession = true
+		for _, shardId := range opts.Config.LocalShards() {
+			dg, err := discordgo.New("Bot " + opts.Config.BotToken)
+			if err != nil {
+				b.Close() //nolint:errcheck
+				return nil, fmt.Errorf("error creating Discord session: %w", err)
+			}
+			dg.ShardID = shardId
+			dg.ShardCount = opts.Config.ShardCount
+			b.sessions = append(b.sessions, dg)
+		}
+	}
+
+	for _, s := range b.sessions {
+		// Register callbacks for MessageCreate, GuildCreate and GuildMembersChunk events.
+		s.AddHandler(discordapi.MessageCreate)
+		s.AddHandler(discordapi.GuildCreate)
+		s.AddHandler(discordapi.GuildMembersChunk)
+
+		s.Identify.Intents |= discordgo.IntentGuilds |
+			discordgo.IntentGuildMembers |
+			discordgo.IntentGuildPresences |
+			discordgo.IntentGuildMessages
+	}
+
+	return b, nil
+}
+
+// Session returns the Discord session used by b, or the session of its first local shard.
+// Any session can be used with the REST API.
+func (b *Bot) Session() *discordgo.Session {
+	return b.sessions[0]
+}
+
+// Sessions returns the Discord sessions used by b, one for each local shard.
+func (b *Bot) Sessions() []*discordgo.Session {
+	return b.sessions
+}
+
+// Run opens the Discord session if b created it, then answers commands and runs the scheduled Elo update
+// until ctx is done. Scheduled updates that are running when ctx is done are waited for.
+//
+// Several instances can run the same shards for availability. They all answer commands, but a Postgres
+// advisory lock elects a single leader for each shard to run its scheduled updates. If the leader dies,
+// another instance takes over.
+func (b *Bot) Run(ctx context.Context) error {
+	if b.ownsSession {
+		// Open a websocket connection to Discord for each shard and begin listening.
+		for i, s := range b.sessions {
+			if i > 0 {
+				time.Sleep(shardIdentifyInterval)
+			}
+			if err := s.Open(); err != nil {
+				return fmt.Errorf("error opening connection to Discord for shard %d: %w", s.ShardID, err)
+			}
+		}
+	}
+
+	c := cron.New()
+	if _, err := c.AddFunc("@midnight", func() {
+		log.Println("Running scheduled Elo update.")
+
+		if err := discordapi.UpdateShardedElo(b.leadGuilds()); err != nil {
+			log.Printf("error updating elo: %v\n", err)
+		}
+
+		log.Println("Scheduled Elo update complete.")
+	}); err != nil {
+		return fmt.Errorf("error adding cron job: %w", err)
+	}
+	if _, err := c.AddFunc(config.Get().DigestSchedule, func() {
+		log.Println("Posting weekly digests.")
+
+		if err := discordapi.PostDigests(b.leadGuilds()); err != nil {
+			log.Printf("error posting digests: %v\n", err)
+		}
+	}); err != nil {
+		return fmt.Errorf("error adding digest cron job: %w", err)
+	}
+	c.Start()
+
+	// Leadership is only given up once running scheduled work is done.
+	elector := db.NewLeaderElector()
+	defer elector.Close(context.Background()) //nolint:errcheck
+	electionDone := make(chan struct{})
+	go func() {
+		defer close(electionDone)
+		b.electLeader(ctx, elector)
+	}()
+
+	if b.opts.ReloadConfig {
+		go watchConfig(ctx)
+	}
+
+	<-ctx.Done()
+
+	<-electionDone
+
+	<-c.Stop().Done()
+
+	return nil
+}
+
+// Close stops pending role change retries, and closes the Discord sessions and database connection pool
+// if they were created by b.
+func (b *Bot) Close() error {
+	for _, s := range b.sessions {
+		discordapi.CancelRoleRetries(s)
+	}
+
+	var err error
+	if b.ownsSession {
+		for _, s := range b.sessions {
+			if closeErr := s.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}
+	}
+	if b.ownsDB && b.opts.DB != nil {
+		b.opts.DB.Close()
+	}
+
+	activeBot.Lock()
+	if activeBot.bot == b {
+		activeBot.bot = nil
+	}
+	activeBot.Unlock()
+
+	return err
+}
+
+// leadGuilds returns the guilds of the local shards led by b, mapped to the session they are connected through.
+func (b *Bot) leadGuilds() map[string]*discordgo.Session {
+	leading, _ := b.leading.Load().(map[int]bool)
+	guilds := make(map[string]*discordgo.Session)
+	for _, s := range b.sessions {
+		if !leading[s.ShardID] {
+			log.Printf("Skipping scheduled work for shard %d, which is led by another instance.\n", s.ShardID)
+			continue
+		}
+		for _, guildId := range getGuildIds(s) {
+			guilds[guildId] = s
+		}
+	}
+
+	return guilds
+}
+
+// electLeader claims and keeps leadership of the local shards whose leader is not running with elector,
+// until ctx is done.
+func (b *Bot) electLeader(ctx context.Context, elector *db.LeaderElector) {
+	shardIds := make([]int, len(b.sessions))
+	for i, s := range b.sessions {
+		shardIds[i] = s.ShardID
+	}
+
+	ticker := time.NewTicker(leaderElectionInterval)
+	defer ticker.Stop()
+
+	var leading map[int]bool
+	for {
+		newLeading, err := elector.Elect(ctx, shardIds)
+		if err != nil && ctx.Err() == nil {
+			log.Println(err)
+		}
+		for _, shardId := range shardIds {
+			if newLeading[shardId] && !leading[shardId] {
+				log.Printf("Leading scheduled work for shard %d.\n", shardId)
+			} else if !newLeading[shardId] && leading[shardId] {
+				log.Printf("Lost leadership of shard %d.\n", shardId)
+			}
+		}
+		leading = newLeading
+		b.leading.Store(leading)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// watchConfig reloads the config file when the process receives SIGHUP or the file is modified,
+// until ctx is done.
+func watchConfig(ctx context.Context) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	defer signal.Stop(sighup)
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sighup:
+		case <-ticker.C:
+			if !config.FileChanged() {
+				continue
+			}
+		}
+
+		changes, err := config.Reload()
+		if err != nil {
+			log.Printf("error reloading config, keeping previous config: %v\n", err)
+			continue
+		}
+		if len(changes) == 0 {
+			log.Println("Config reloaded with no changes.")
+		} else {
+			log.Printf("Config reloaded: %s\n", strings.Join(changes, ", "))
+		}
+	}
+}
+
+// getGuildIds returns the IDs of the guilds in the state of s that belong to its shard.
+func getGuildIds(s *discordgo.Session) []string {
+	s.State.RLock()
+	defer s.State.RUnlock()
+
+	guildIds := make([]string, 0, len(s.State.Guilds))
+	for _, guild := range s.State.Guilds {
+		if s.ShardCount > 1 && guildShard(guild.ID, s.ShardCount) != s.ShardID {
+			continue
+		}
+		guildIds = append(guildIds, guild.ID)
+	}
+	return guildIds
+}
+
+// guildShard returns the ID of the shard that receives the events of the guild specified by guildId.
+func guildShard(guildId string, shardCount int) int {
+	id, err := strconv.ParseUint(guildId, 10, 64)
+	if err != nil {
+		return 0
+	}
+
+	return int((id >> 22) % uint64(shardCount))
+}
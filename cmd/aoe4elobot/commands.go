@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/alexisgeoffrey/aoe4elobot/v2/bot"
+	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/config"
+	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/db"
+	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/discordapi"
+	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/export"
+	"github.com/bwmarrin/discordgo"
+)
+
+func initConfig(args []string) int {
+	fs := flag.NewFlagSet("init-config", flag.ExitOnError)
+	configPath := configFlag(fs)
+	force := fs.Bool("force", false, "overwrite an existing config file")
+	fs.Parse(args) //nolint:errcheck
+
+	if _, err := os.Stat(*configPath); err == nil && !*force {
+		log.Printf("config file %s already exists, use -force to overwrite it\n", *configPath)
+		return 1
+	}
+
+	if err := config.Generate(*configPath); err != nil {
+		log.Printf("error generating config file: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Sample config file written to %s.\n", *configPath)
+	return 0
+}
+
+// validateConfig checks the config file and prints all problems found, optionally checking
+// the roles and channels it references against a guild.
+func validateConfig(args []string) int {
+	fs := flag.NewFlagSet("validate-config", flag.ExitOnError)
+	configPath := configFlag(fs)
+	guildId := fs.String("guild", "", "also check roles, channels and permissions on this server")
+	fs.Parse(args) //nolint:errcheck
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Printf("error reading config file: %v\n", err)
+		return 1
+	}
+	config.Set(cfg)
+	problems := cfg.Validate()
+
+	if *guildId != "" {
+		closeDB, err := openDBReadOnly(cfg)
+		if err != nil {
+			log.Println(err)
+			return 1
+		}
+		defer closeDB()
+
+		dg, err := discordgo.New("Bot " + cfg.BotToken)
+		if err != nil {
+			log.Printf("error creating Discord session: %v\n", err)
+			return 1
+		}
+
+		guildProblems, err := discordapi.ValidateGuild(dg, *guildId)
+		if err != nil {
+			log.Printf("error validating guild: %v\n", err)
+			return 1
+		}
+		problems = append(problems, guildProblems...)
+	}
+
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	if config.HasErrors(problems) {
+		return 1
+	}
+
+	fmt.Println("Config file is valid.")
+	return 0
+}
+
+func migrate(args []string) int {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	configPath := configFlag(fs)
+	fs.Parse(args) //nolint:errcheck
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+
+	closeDB, err := openDB(cfg)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	defer closeDB()
+
+	fmt.Println("Database is up to date.")
+	return 0
+}
+
+// update retrieves Elo and updates Elo roles on a guild without connecting to the Discord gateway.
+func update(args []string) int {
+	fs := flag.NewFlagSet("update", flag.ExitOnError)
+	configPath := configFlag(fs)
+	guildId := fs.String("guild", "", "ID of the server to update (required)")
+	userId := fs.String("user", "", "ID of a single member to update")
+	dryRun := fs.Bool("dry-run", false, "print the Elo role changes for the server without making them")
+	fs.Parse(args) //nolint:errcheck
+
+	if *guildId == "" || (*dryRun && *userId != "") {
+		fs.Usage()
+		return 2
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+
+	b, err := bot.New(context.Background(), bot.Options{Config: cfg})
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	defer b.Close() //nolint:errcheck
+
+	if err := discordapi.LoadGuildState(b.Session(), *guildId); err != nil {
+		log.Println(err)
+		return 1
+	}
+
+	if *dryRun {
+		plan, err := discordapi.PlanGuildElo(b.Session(), *guildId)
+		if err != nil {
+			log.Printf("error planning elo update: %v\n", err)
+			return 1
+		}
+		fmt.Print(discordapi.FormatPlan(b.Session(), *guildId, plan, cfg.Locale))
+		return 0
+	}
+
+	if *userId != "" {
+		err = discordapi.UpdateMemberElo(b.Session(), *guildId, *userId)
+	} else {
+		err = discordapi.UpdateGuildElo(b.Session(), *guildId)
+	}
+	if err != nil {
+		log.Printf("error updating elo: %v\n", err)
+		return 1
+	}
+
+	fmt.Println("Elo updated.")
+	return 0
+}
+
+func listUsers(args []string) int {
+	fs := flag.NewFlagSet("list-users", flag.ExitOnError)
+	configPath := configFlag(fs)
+	guildId := fs.String("guild", "", "ID of the server (required)")
+	fs.Parse(args) //nolint:errcheck
+
+	if *guildId == "" {
+		fs.Usage()
+		return 2
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+
+	closeDB, err := openDBReadOnly(cfg)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	defer closeDB()
+
+	users, err := db.GetUsers(*guildId)
+	if err != nil {
+		log.Printf("error getting users: %v\n", err)
+		return 1
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprint(w, "DISCORD ID\tAOE4 USERNAME\tAOE4 ID\tPRIMARY")
+	for i, mode := range db.Modes {
+		if cfg.EloTypes[i].Enabled {
+			fmt.Fprintf(w, "\t%s", mode)
+		}
+	}
+	fmt.Fprintln(w)
+
+	for _, u := range users {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%t", u.DiscordUserID, u.Aoe4Username, u.Aoe4Id, u.IsPrimary)
+		for i, elo := range u.CurrentElo.Values() {
+			if cfg.EloTypes[i].Enabled {
+				fmt.Fprintf(w, "\t%d", elo)
+			}
+		}
+		fmt.Fprintln(w)
+	}
+	if err := w.Flush(); err != nil {
+		log.Println(err)
+		return 1
+	}
+
+	return 0
+}
+
+func exportRegistrations(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	configPath := configFlag(fs)
+	guildId := fs.String("guild", "", "ID of the server to export, or all servers if empty")
+	output := fs.String("output", "", "file to write to, or standard output if empty")
+	format := fs.String("format", "", "json or csv, defaults to the extension of the output file or json")
+	fs.Parse(args) //nolint:errcheck
+
+	if *format == "" {
+		*format = export.FormatFromName(*output)
+	}
+	if !export.IsFormat(*format) {
+		log.Printf("unsupported format %q\n", *format)
+		return 2
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+
+	closeDB, err := openDBReadOnly(cfg)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	defer closeDB()
+
+	regs, err := db.ExportRegistrations(*guildId)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			log.Printf("error creating export file: %v\n", err)
+			return 1
+		}
+		defer file.Close()
+		w = file
+	}
+
+	if err := export.Write(w, regs, *format); err != nil {
+		log.Printf("error writing export: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+func importRegistrations(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	configPath := configFlag(fs)
+	input := fs.String("input", "", "file to read from (required)")
+	format := fs.String("format", "", "json or csv, defaults to the extension of the input file")
+	onConflict := fs.String("on-conflict", "skip", "skip or overwrite existing registrations and ratings")
+	guildId := fs.String("guild", "", "only import registrations for this server")
+	fs.Parse(args) //nolint:errcheck
+
+	if *input == "" || (*onConflict != "skip" && *onConflict != "overwrite") {
+		fs.Usage()
+		return 2
+	}
+	if *format == "" {
+		*format = export.FormatFromName(*input)
+	}
+
+	file, err := os.Open(*input)
+	if err != nil {
+		log.Printf("error opening import file: %v\n", err)
+		return 1
+	}
+	defer file.Close()
+
+	regs, err := export.Read(file, *format)
+	if err != nil {
+		log.Printf("error reading import file: %v\n", err)
+		return 1
+	}
+
+	var ignored int
+	if *guildId != "" {
+		regs, ignored = export.FilterGuild(regs, *guildId)
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+
+	closeDB, err := openDB(cfg)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	defer closeDB()
+
+	imported, skipped, err := db.ImportRegistrations(regs, *onConflict == "overwrite")
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+
+	fmt.Printf("Imported %d registrations, skipped %d existing and ignored %d for other servers.\n",
+		imported, skipped, ignored)
+	return 0
+}
+
+// openDB connects to the database specified by cfg and applies any pending migrations.
+// It returns a function that closes the connection.
+func openDB(cfg *config.ConfigFile) (closeDB func(), err error) {
+	if db.Db, err = db.Connect(context.Background(), cfg.DbUrl); err != nil {
+		return nil, err
+	}
+
+	if err := db.Migrate(context.Background()); err != nil {
+		db.Db.Close()
+		return nil, fmt.Errorf("error setting up database: %w", err)
+	}
+
+	return db.Db.Close, nil
+}
+
+// openDBReadOnly connects to the database of cfg for commands that only read from it, so pending
+// migrations are reported instead of applied.
+func openDBReadOnly(cfg *config.ConfigFile) (closeDB func(), err error) {
+	if db.Db, err = db.Connect(context.Background(), cfg.DbUrl); err != nil {
+		return nil, err
+	}
+
+	if err := db.CheckSchema(context.Background()); err != nil {
+		db.Db.Close()
+		return nil, err
+	}
+
+	return db.Db.Close, nil
+}
@@ -1,76 +1,121 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
+	"github.com/alexisgeoffrey/aoe4elobot/v2/bot"
 	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/config"
-	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/db"
-	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/discordapi"
-	"github.com/bwmarrin/discordgo"
-	"github.com/robfig/cron/v3"
 )
 
+const usage = `Usage: aoe4elobot [command] [flags]
+
+Commands:
+  run              Run the bot (default)
+  init-config      Write a sample config file
+  validate-config  Check the config file for problems
+  migrate          Apply pending database migrations
+  update           Update Elo and Elo roles on a server
+  list-users       List the users registered on a server
+  export           Export registrations and ratings
+  import           Import registrations and ratings
+
+Run "aoe4elobot COMMAND -h" for the flags of a command.
+`
+
+var commands = map[string]func(args []string) int{
+	"run":             run,
+	"init-config":     initConfig,
+	"validate-config": validateConfig,
+	"migrate":         migrate,
+	"update":          update,
+	"list-users":      listUsers,
+	"export":          exportRegistrations,
+	"import":          importRegistrations,
+}
+
 func main() {
-	// Create a new Discord session using the provided bot token.
-	dg, err := discordgo.New("Bot " + config.Cfg.BotToken)
-	if err != nil {
-		log.Fatalf("error creating Discord session: %v\n", err)
+	name, args := "run", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
 	}
 
-	// Register the messageCreate func as a callback for MessageCreate events.
-	dg.AddHandler(discordapi.MessageCreate)
-
-	dg.Identify.Intents = discordgo.IntentGuilds |
-		discordgo.IntentGuildMembers |
-		discordgo.IntentGuildPresences |
-		discordgo.IntentGuildMessages
+	if name == "help" {
+		fmt.Print(usage)
+		return
+	}
 
-	// Open a websocket connection to Discord and begin listening.
-	if err := dg.Open(); err != nil {
-		log.Fatalf("error opening connection to Discord: %v\n", err)
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", name, usage)
+		os.Exit(2)
 	}
 
-	c := cron.New()
-	if _, err = c.AddFunc("@midnight", func() {
-		log.Println("Running scheduled Elo update.")
+	os.Exit(cmd(args))
+}
 
-		for _, id := range getGuildIds(dg.State) {
-			if err := discordapi.UpdateGuildElo(dg, id); err != nil {
-				log.Printf("error updating elo on server %s: %v\n", id, err)
-				continue
-			}
-		}
+func run(args []string) int {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	configPath := configFlag(fs)
+	fs.Parse(args) //nolint:errcheck
 
-		log.Println("Scheduled Elo update complete.")
-	}); err != nil {
-		log.Fatalf("error adding cron job: %v\n", err)
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		log.Println(err)
+		return 1
 	}
-	c.Start()
 
-	// Wait here until CTRL-C or other term signal is received.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	b, err := bot.New(ctx, bot.Options{Config: cfg, ReloadConfig: true})
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+
+	// Run until CTRL-C or other term signal is received.
 	fmt.Println("AOE4 Elo Bot is now running. Press Ctrl-C to exit.")
-	sc := make(chan os.Signal, 1)
-	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
-	<-sc
+	status := 0
+	if err := b.Run(ctx); err != nil {
+		log.Println(err)
+		status = 1
+	}
 
-	// Cleanly close down the Cron job and Discord session.
+	// Cleanly close down the Discord session and database connection.
 	fmt.Println("Shutting down...")
-	c.Stop()
-	dg.Close()
-	db.Db.Close()
+	if err := b.Close(); err != nil {
+		log.Printf("error closing bot: %v\n", err)
+	}
+
+	return status
 }
 
-func getGuildIds(st *discordgo.State) []string {
-	st.RLock()
-	defer st.RUnlock()
+// configFlag defines the flag for the path of the config file on fs.
+func configFlag(fs *flag.FlagSet) *string {
+	return fs.String("config", config.Path(), "path of the config file")
+}
 
-	guildIds := make([]string, len(st.Guilds))
-	for i, guild := range st.Guilds {
-		guildIds[i] = guild.ID
+// loadConfig reads the config file at path, logs any problems in it and makes it the config in use.
+func loadConfig(path string) (*config.ConfigFile, error) {
+	cfg, err := config.Load(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("config file %s does not exist, run init-config to create one", path)
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
 	}
-	return guildIds
+
+	for _, problem := range cfg.Validate() {
+		log.Println(problem)
+	}
+	config.Set(cfg)
+
+	return cfg, nil
 }
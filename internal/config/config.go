@@ -1,10 +1,12 @@
 package config
 
 import (
-	"errors"
 	"fmt"
-	"log"
 	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 	"gopkg.in/yaml.v3"
@@ -12,47 +14,81 @@ import (
 
 type (
 	ConfigFile struct {
-		AdminRolesMap map[string]bool `yaml:"-"`
-		DbUrl         string          `yaml:"db_url" env:"DB_URL" env-required:"true"`
-		BotToken      string          `yaml:"bot_token" env:"BOT_TOKEN" env-required:"true"`
-		BotChannelId  string          `yaml:"bot_channel_id" env-required:"true"`
-		AdminRoles    []string        `yaml:"admin_roles,flow"`
-		EloTypes      []EloType       `yaml:"-"`
-		OneVOne       EloType         `yaml:"1v1"`
-		TwoVTwo       EloType         `yaml:"2v2"`
-		ThreeVThree   EloType         `yaml:"3v3"`
-		FourVFour     EloType         `yaml:"4v4"`
-		Custom        EloType
+		AdminRolesMap    map[string]bool `yaml:"-"`
+		DbUrl            string          `yaml:"db_url" env:"DB_URL" env-required:"true"`
+		BotToken         string          `yaml:"bot_token" env:"BOT_TOKEN" env-required:"true"`
+		BotChannelId     string          `yaml:"bot_channel_id" env-required:"true"`
+		ModLogChannelId  string          `yaml:"mod_log_channel_id,omitempty"`
+		CommandPrefix    string          `yaml:"command_prefix"`
+		MentionPrefix    bool            `yaml:"mention_prefix"`
+		Locale           string          `yaml:"locale" env-default:"en"`
+		RoleAccountRule  string          `yaml:"role_account_rule" env-default:"best"`
+		StaleAfter       time.Duration   `yaml:"stale_after,omitempty" env-default:"48h"`
+		FailureThreshold int             `yaml:"failure_threshold,omitempty" env-default:"3"`
+		RatingCacheTTL   time.Duration   `yaml:"rating_cache_ttl,omitempty" env-default:"5m"`
+		DigestSchedule   string          `yaml:"digest_schedule,omitempty" env-default:"0 18 * * 0"`
+		DigestSize       int             `yaml:"digest_size,omitempty" env-default:"5"`
+		ShardCount       int             `yaml:"shard_count,omitempty" env:"SHARD_COUNT" env-default:"1"`
+		ShardIds         []int           `yaml:"shard_ids,omitempty,flow" env:"SHARD_IDS"`
+		AdminRoles       []string        `yaml:"admin_roles,flow"`
+		EloTypes         []EloType       `yaml:"-"`
+		OneVOne          EloType         `yaml:"1v1"`
+		TwoVTwo          EloType         `yaml:"2v2"`
+		ThreeVThree      EloType         `yaml:"3v3"`
+		FourVFour        EloType         `yaml:"4v4"`
+		Custom           EloType
+		path             string
+		modTime          time.Time
 	}
 
 	EloType struct {
-		RoleMap map[string]int16 `yaml:"-"`
-		Roles   []EloRole        `yaml:"roles,omitempty"`
-		Enabled bool
+		RoleMap           map[string]int16 `yaml:"-"`
+		Roles             []EloRole        `yaml:"roles,omitempty"`
+		Enabled           bool
+		Preset            string            `yaml:"preset,omitempty"`
+		PresetRoleIds     map[string]string `yaml:"preset_role_ids,omitempty"`
+		UseReportedLeague bool              `yaml:"use_reported_league,omitempty"`
+		InactiveAfter     time.Duration     `yaml:"inactive_after,omitempty"`
+		InactiveRoleId    string            `yaml:"inactive_role_id,omitempty"`
+		presetExpanded    bool
 	}
 
 	EloRole struct {
-		RoleId       string `yaml:"role_id"`
+		Name         string `yaml:"name,omitempty"`
+		Color        string `yaml:"color,omitempty"`
+		RoleId       string `yaml:"role_id,omitempty"`
 		RolePriority int16  `yaml:"role_priority"`
 		StartingElo  int16  `yaml:"starting_elo"`
 		EndingElo    int16  `yaml:"ending_elo"`
 	}
 )
 
+// Values for RoleAccountRule, which selects the linked accounts used for role assignment.
+const (
+	RoleAccountRulePrimary = "primary"
+	RoleAccountRuleBest    = "best"
+)
+
+// InactiveRolePriority is the priority of the inactive role of an Elo type, which is lower than any Elo role.
+const InactiveRolePriority int16 = 9999
+
 const UserAgent = "AOE 4 Elo Bot/2.0.0 (github.com/alexisgeoffrey/aoe4elobot; alexisgeoffrey1@gmail.com)"
 
-var Cfg ConfigFile
+// current holds the *ConfigFile in use, which is replaced as a whole when the config file is reloaded.
+var current atomic.Value
 
 var (
 	sampleEloRoles = []EloRole{
 		{
-			RoleId:       "eloRoleId1",
+			Name:         "Elo 500-1000",
+			Color:        "#c0c0c0",
 			StartingElo:  500,
 			EndingElo:    1000,
 			RolePriority: 200,
 		},
 		{
-			RoleId:       "eloRoleId2",
+			Name:         "Elo 1001-2000",
+			Color:        "#ffd700",
 			StartingElo:  1001,
 			EndingElo:    2000,
 			RolePriority: 100,
@@ -61,57 +97,145 @@ var (
 	sampleAdminRoles = []string{"adminRoleId1", "adminRoleId2"}
 )
 
-func init() {
-	configPath := os.Getenv("CONFIG_PATH")
-	if configPath == "" {
-		configPath = "config.yml"
+// Path returns the path of the config file, which is set by the CONFIG_PATH environment variable
+// and defaults to config.yml in the working directory.
+func Path() string {
+	if configPath := os.Getenv("CONFIG_PATH"); configPath != "" {
+		return configPath
 	}
 
-	err := cleanenv.ReadConfig(configPath, &Cfg)
-	if errors.Is(err, os.ErrNotExist) {
-		if err := genConfig(configPath); err != nil {
-			log.Printf("error generating config file: %v", err)
-		}
-		os.Exit(1)
-	} else if err != nil {
-		log.Fatalf("error reading config file: %v\n", err)
+	return "config.yml"
+}
+
+// Get returns the config in use. The returned config must not be modified.
+// Operations that span several steps should call Get once and use the result throughout,
+// so that they are not affected by a reload.
+func Get() *ConfigFile {
+	cfg, _ := current.Load().(*ConfigFile)
+	return cfg
+}
+
+// Set replaces the config in use with cfg.
+func Set(cfg *ConfigFile) {
+	current.Store(cfg)
+}
+
+// Load reads the config file at path.
+func Load(path string) (*ConfigFile, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &ConfigFile{path: path, modTime: info.ModTime()}
+	if err := cleanenv.ReadConfig(path, cfg); err != nil {
+		return nil, err
+	}
+
+	// An empty command_prefix is kept for servers that only use mention_prefix,
+	// so the default prefix is only used when it is missing from the file.
+	hasPrefix, err := hasKey(path, "command_prefix")
+	if err != nil {
+		return nil, err
+	}
+	if !hasPrefix {
+		cfg.CommandPrefix = "!"
 	}
 
 	for _, eloType := range []*EloType{
-		&Cfg.OneVOne,
-		&Cfg.TwoVTwo,
-		&Cfg.ThreeVThree,
-		&Cfg.FourVFour,
-		&Cfg.Custom,
+		&cfg.OneVOne,
+		&cfg.TwoVTwo,
+		&cfg.ThreeVThree,
+		&cfg.FourVFour,
+		&cfg.Custom,
 	} {
-		if eloType.Enabled && len(eloType.Roles) != 0 {
-			eloType.RoleMap = make(map[string]int16, len(eloType.Roles))
-			for _, role := range eloType.Roles {
-				eloType.RoleMap[role.RoleId] = role.RolePriority
-			}
-		}
+		eloType.expandPreset()
+		eloType.BuildRoleMap()
 	}
 
-	Cfg.EloTypes = []EloType{
-		Cfg.OneVOne,
-		Cfg.TwoVTwo,
-		Cfg.ThreeVThree,
-		Cfg.FourVFour,
-		Cfg.Custom,
+	cfg.EloTypes = []EloType{
+		cfg.OneVOne,
+		cfg.TwoVTwo,
+		cfg.ThreeVThree,
+		cfg.FourVFour,
+		cfg.Custom,
 	}
 
-	Cfg.AdminRolesMap = make(map[string]bool, len(Cfg.AdminRoles))
-	for _, role := range Cfg.AdminRoles {
-		Cfg.AdminRolesMap[role] = true
+	cfg.AdminRolesMap = make(map[string]bool, len(cfg.AdminRoles))
+	for _, role := range cfg.AdminRoles {
+		cfg.AdminRolesMap[role] = true
 	}
+
+	return cfg, nil
 }
 
-func genConfig(path string) error {
-	log.Println("Config file does not exist. Creating...")
+// hasKey reports whether the config file at path sets key.
+func hasKey(path string, key string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
 
-	Cfg.OneVOne = EloType{Enabled: true, Roles: sampleEloRoles}
-	Cfg.AdminRoles = sampleAdminRoles
-	Cfg.BotChannelId = "botChannelId"
+	var keys map[string]interface{}
+	if err := yaml.Unmarshal(data, &keys); err != nil {
+		return false, fmt.Errorf("error parsing config file: %w", err)
+	}
+	_, ok := keys[key]
+
+	return ok, nil
+}
+
+// LocalShards returns the IDs of the shards run by this process, which are all shards unless ShardIds is set.
+func (cfg *ConfigFile) LocalShards() []int {
+	if len(cfg.ShardIds) != 0 {
+		return cfg.ShardIds
+	}
+
+	shardIds := make([]int, cfg.ShardCount)
+	for i := range shardIds {
+		shardIds[i] = i
+	}
+	return shardIds
+}
+
+// BuildRoleMap sets the RoleMap of eloType from the IDs of its roles and inactive role.
+func (eloType *EloType) BuildRoleMap() {
+	eloType.RoleMap = nil
+	if !eloType.Enabled || len(eloType.Roles) == 0 {
+		return
+	}
+
+	eloType.RoleMap = make(map[string]int16, len(eloType.Roles))
+	for _, role := range eloType.Roles {
+		if role.RoleId != "" {
+			eloType.RoleMap[role.RoleId] = role.RolePriority
+		}
+	}
+	if eloType.InactiveRoleId != "" {
+		eloType.RoleMap[eloType.InactiveRoleId] = InactiveRolePriority
+	}
+}
+
+// ColorValue returns the color of the role as an integer, or 0 if the role has no valid color.
+func (role EloRole) ColorValue() int {
+	color, err := strconv.ParseInt(strings.TrimPrefix(role.Color, "#"), 16, 32)
+	if err != nil {
+		return 0
+	}
+
+	return int(color)
+}
+
+// Generate writes a sample config file to path.
+func Generate(path string) error {
+	cfg := ConfigFile{
+		OneVOne:         EloType{Enabled: true, Roles: sampleEloRoles},
+		AdminRoles:      sampleAdminRoles,
+		BotChannelId:    "botChannelId",
+		CommandPrefix:   "!",
+		Locale:          "en",
+		RoleAccountRule: RoleAccountRuleBest,
+	}
 
 	file, err := os.Create(path)
 	if err != nil {
@@ -119,7 +243,7 @@ func genConfig(path string) error {
 	}
 	defer file.Close()
 
-	yamlBytes, err := yaml.Marshal(Cfg)
+	yamlBytes, err := yaml.Marshal(cfg)
 	if err != nil {
 		return fmt.Errorf("error marshaling yaml struct: %w", err)
 	}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadCommandPrefix(t *testing.T) {
+	const base = "db_url: postgres://localhost/elobot\nbot_token: token\nbot_channel_id: \"100000000000000001\"\n"
+
+	tests := []struct {
+		name string
+		yaml string
+		want string
+	}{
+		{"missing", "", "!"},
+		{"empty", "command_prefix: \"\"\nmention_prefix: true\n", ""},
+		{"set", "command_prefix: \"?\"\n", "?"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yml")
+			if err := os.WriteFile(path, []byte(base+tt.yaml), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := Load(path)
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if cfg.CommandPrefix != tt.want {
+				t.Errorf("CommandPrefix = %q, want %q", cfg.CommandPrefix, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"strings"
+	"unicode"
+)
+
+// PresetRankedLeagues is the name of the preset matching the in-game ranked leagues.
+const PresetRankedLeagues = "ranked_leagues"
+
+// presets maps preset names to the roles they expand to.
+// Role IDs are filled in from the PresetRoleIds of the Elo type using the preset,
+// and roles without an ID are created by the bot.
+var presets = map[string][]EloRole{
+	PresetRankedLeagues: {
+		{Name: "Bronze I", Color: "#cd7f32", StartingElo: 0, EndingElo: 399, RolePriority: 180},
+		{Name: "Bronze II", Color: "#cd7f32", StartingElo: 400, EndingElo: 449, RolePriority: 170},
+		{Name: "Bronze III", Color: "#cd7f32", StartingElo: 450, EndingElo: 499, RolePriority: 160},
+		{Name: "Silver I", Color: "#c0c0c0", StartingElo: 500, EndingElo: 549, RolePriority: 150},
+		{Name: "Silver II", Color: "#c0c0c0", StartingElo: 550, EndingElo: 599, RolePriority: 140},
+		{Name: "Silver III", Color: "#c0c0c0", StartingElo: 600, EndingElo: 649, RolePriority: 130},
+		{Name: "Gold I", Color: "#ffd700", StartingElo: 650, EndingElo: 699, RolePriority: 120},
+		{Name: "Gold II", Color: "#ffd700", StartingElo: 700, EndingElo: 749, RolePriority: 110},
+		{Name: "Gold III", Color: "#ffd700", StartingElo: 750, EndingElo: 799, RolePriority: 100},
+		{Name: "Platinum I", Color: "#4fc1b9", StartingElo: 800, EndingElo: 899, RolePriority: 90},
+		{Name: "Platinum II", Color: "#4fc1b9", StartingElo: 900, EndingElo: 999, RolePriority: 80},
+		{Name: "Platinum III", Color: "#4fc1b9", StartingElo: 1000, EndingElo: 1099, RolePriority: 70},
+		{Name: "Diamond I", Color: "#3fa9f5", StartingElo: 1100, EndingElo: 1199, RolePriority: 60},
+		{Name: "Diamond II", Color: "#3fa9f5", StartingElo: 1200, EndingElo: 1299, RolePriority: 50},
+		{Name: "Diamond III", Color: "#3fa9f5", StartingElo: 1300, EndingElo: 1399, RolePriority: 40},
+		{Name: "Conqueror I", Color: "#e03c31", StartingElo: 1400, EndingElo: 1499, RolePriority: 30},
+		{Name: "Conqueror II", Color: "#e03c31", StartingElo: 1500, EndingElo: 1599, RolePriority: 20},
+		{Name: "Conqueror III", Color: "#e03c31", StartingElo: 1600, EndingElo: 32767, RolePriority: 10},
+	},
+}
+
+// expandPreset replaces the roles of eloType with the roles of its preset, if it has a known preset
+// and no roles of its own. Invalid presets are reported by Validate.
+func (eloType *EloType) expandPreset() {
+	presetRoles, ok := presets[eloType.Preset]
+	if !ok || len(eloType.Roles) != 0 {
+		return
+	}
+
+	eloType.Roles = make([]EloRole, len(presetRoles))
+	for i, role := range presetRoles {
+		role.RoleId = eloType.PresetRoleIds[role.Name]
+		eloType.Roles[i] = role
+	}
+	eloType.presetExpanded = true
+}
+
+func presetHasRole(preset string, name string) bool {
+	for _, role := range presets[preset] {
+		if role.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// LeagueKey normalizes a league name so that names reported in different formats,
+// such as "Gold III", "gold_3" and "GOLD 3", compare equal.
+func LeagueKey(name string) string {
+	key := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+
+	for _, numeral := range [...]struct{ roman, arabic string }{{"iii", "3"}, {"ii", "2"}, {"i", "1"}} {
+		if strings.HasSuffix(key, numeral.roman) {
+			return strings.TrimSuffix(key, numeral.roman) + numeral.arabic
+		}
+	}
+
+	return key
+}
@@ -0,0 +1,95 @@
+package config
+
+import "testing"
+
+func TestLeagueKey(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Gold III", "gold3"},
+		{"gold_3", "gold3"},
+		{"GOLD 3", "gold3"},
+		{"Gold II", "gold2"},
+		{"gold_2", "gold2"},
+		{"Gold I", "gold1"},
+		{"gold_1", "gold1"},
+		{"Conqueror III", "conqueror3"},
+		{"conqueror_3", "conqueror3"},
+		{"Unranked", "unranked"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := LeagueKey(tt.name); got != tt.want {
+			t.Errorf("LeagueKey(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestExpandPreset(t *testing.T) {
+	ownRoles := []EloRole{{Name: "Own", StartingElo: 0, EndingElo: 32767, RolePriority: 10}}
+
+	tests := []struct {
+		name     string
+		eloType  EloType
+		roles    int
+		expanded bool
+		roleIds  map[string]string
+	}{
+		{
+			name: "preset",
+			eloType: EloType{
+				Preset:        PresetRankedLeagues,
+				PresetRoleIds: map[string]string{"Gold I": "100000000000000001", "Conqueror III": "100000000000000002"},
+			},
+			roles:    len(presets[PresetRankedLeagues]),
+			expanded: true,
+			roleIds:  map[string]string{"Gold I": "100000000000000001", "Conqueror III": "100000000000000002", "Bronze I": ""},
+		},
+		{
+			name:    "preset with own roles",
+			eloType: EloType{Preset: PresetRankedLeagues, Roles: ownRoles},
+			roles:   len(ownRoles),
+		},
+		{
+			name:    "unknown preset",
+			eloType: EloType{Preset: "unknown"},
+		},
+		{
+			name:    "no preset",
+			eloType: EloType{Roles: ownRoles},
+			roles:   len(ownRoles),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eloType := tt.eloType
+			eloType.expandPreset()
+
+			if len(eloType.Roles) != tt.roles {
+				t.Errorf("len(Roles) = %d, want %d", len(eloType.Roles), tt.roles)
+			}
+			if eloType.presetExpanded != tt.expanded {
+				t.Errorf("presetExpanded = %v, want %v", eloType.presetExpanded, tt.expanded)
+			}
+			for _, role := range eloType.Roles {
+				if want, ok := tt.roleIds[role.Name]; ok && role.RoleId != want {
+					t.Errorf("RoleId of %q = %q, want %q", role.Name, role.RoleId, want)
+				}
+			}
+		})
+	}
+}
+
+func TestExpandPresetDoesNotModifyPreset(t *testing.T) {
+	eloType := EloType{Preset: PresetRankedLeagues, PresetRoleIds: map[string]string{"Gold I": "100000000000000001"}}
+	eloType.expandPreset()
+
+	for _, role := range presets[PresetRankedLeagues] {
+		if role.RoleId != "" {
+			t.Fatalf("preset role %q has role ID %q after expansion", role.Name, role.RoleId)
+		}
+	}
+}
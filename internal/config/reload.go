@@ -0,0 +1,113 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+var reloadState struct {
+	// modTime is the modification time of the config file at the last reload attempt,
+	// so that an invalid file is not reloaded again until it is modified.
+	modTime time.Time
+	sync.Mutex
+}
+
+// FileChanged reports whether the config file has been modified since it was last loaded or reloaded.
+func FileChanged() bool {
+	cfg := Get()
+	info, err := os.Stat(cfg.path)
+	if err != nil {
+		return false
+	}
+
+	reloadState.Lock()
+	defer reloadState.Unlock()
+	if reloadState.modTime.IsZero() {
+		return !info.ModTime().Equal(cfg.modTime)
+	}
+	return !info.ModTime().Equal(reloadState.modTime)
+}
+
+// Reload reads the config file again and, if it is valid, replaces the config in use with it.
+// Operations that already called Get keep using the previous config. Reload returns a description
+// of each setting that changed.
+func Reload() (changes []string, err error) {
+	reloadState.Lock()
+	defer reloadState.Unlock()
+
+	old := Get()
+	if info, err := os.Stat(old.path); err == nil {
+		reloadState.modTime = info.ModTime()
+	}
+	cfg, err := Load(old.path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+
+	problems := cfg.Validate()
+	if HasErrors(problems) {
+		msgs := make([]string, 0, len(problems))
+		for _, problem := range problems {
+			if !problem.Warning {
+				msgs = append(msgs, problem.String())
+			}
+		}
+		return nil, errors.New("config file is invalid: " + strings.Join(msgs, "; "))
+	}
+
+	Set(cfg)
+
+	return Diff(old, cfg), nil
+}
+
+// Diff returns a description of each setting that differs between old and cfg.
+func Diff(old *ConfigFile, cfg *ConfigFile) (changes []string) {
+	changed := func(key string, oldValue interface{}, newValue interface{}) {
+		if !reflect.DeepEqual(oldValue, newValue) {
+			changes = append(changes, fmt.Sprintf("%s: %v -> %v", key, oldValue, newValue))
+		}
+	}
+
+	if old.DbUrl != cfg.DbUrl {
+		changes = append(changes, "db_url changed, restart required to take effect")
+	}
+	if old.BotToken != cfg.BotToken {
+		changes = append(changes, "bot_token changed, restart required to take effect")
+	}
+	if old.ShardCount != cfg.ShardCount || !reflect.DeepEqual(old.ShardIds, cfg.ShardIds) {
+		changes = append(changes, "shard_count or shard_ids changed, restart required to take effect")
+	}
+	changed("bot_channel_id", old.BotChannelId, cfg.BotChannelId)
+	changed("mod_log_channel_id", old.ModLogChannelId, cfg.ModLogChannelId)
+	changed("command_prefix", old.CommandPrefix, cfg.CommandPrefix)
+	changed("mention_prefix", old.MentionPrefix, cfg.MentionPrefix)
+	changed("locale", old.Locale, cfg.Locale)
+	changed("role_account_rule", old.RoleAccountRule, cfg.RoleAccountRule)
+	changed("stale_after", old.StaleAfter, cfg.StaleAfter)
+	changed("failure_threshold", old.FailureThreshold, cfg.FailureThreshold)
+	changed("rating_cache_ttl", old.RatingCacheTTL, cfg.RatingCacheTTL)
+	if old.DigestSchedule != cfg.DigestSchedule {
+		changes = append(changes, "digest_schedule changed, restart required to take effect")
+	}
+	changed("digest_size", old.DigestSize, cfg.DigestSize)
+	changed("admin_roles", old.AdminRoles, cfg.AdminRoles)
+
+	for i, key := range EloTypeKeys {
+		oldType, newType := old.EloTypes[i], cfg.EloTypes[i]
+		changed(key+".enabled", oldType.Enabled, newType.Enabled)
+		changed(key+".preset", oldType.Preset, newType.Preset)
+		changed(key+".use_reported_league", oldType.UseReportedLeague, newType.UseReportedLeague)
+		changed(key+".inactive_after", oldType.InactiveAfter, newType.InactiveAfter)
+		changed(key+".inactive_role_id", oldType.InactiveRoleId, newType.InactiveRoleId)
+		if !reflect.DeepEqual(oldType.Roles, newType.Roles) {
+			changes = append(changes, fmt.Sprintf("%s.roles: %d roles -> %d roles", key, len(oldType.Roles), len(newType.Roles)))
+		}
+	}
+
+	return
+}
@@ -0,0 +1,258 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/locale"
+	"github.com/robfig/cron/v3"
+)
+
+// A Problem is an issue found in the config file.
+type Problem struct {
+	// Path is the YAML path of the value with the issue, such as "1v1.roles[2].ending_elo".
+	Path    string
+	Message string
+	// Warning is true if the issue does not prevent the bot from running.
+	Warning bool
+}
+
+func (p Problem) String() string {
+	if p.Warning {
+		return fmt.Sprintf("warning: %s: %s", p.Path, p.Message)
+	}
+	return fmt.Sprintf("error: %s: %s", p.Path, p.Message)
+}
+
+// HasErrors reports whether any of problems is not a warning.
+func HasErrors(problems []Problem) bool {
+	for _, p := range problems {
+		if !p.Warning {
+			return true
+		}
+	}
+
+	return false
+}
+
+// EloTypeKeys holds the YAML keys of the Elo types, in the same order as EloTypes.
+var EloTypeKeys = [...]string{"1v1", "2v2", "3v3", "4v4", "custom"}
+
+type validator struct {
+	problems []Problem
+}
+
+func (v *validator) errorf(path string, format string, args ...interface{}) {
+	v.problems = append(v.problems, Problem{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) warnf(path string, format string, args ...interface{}) {
+	v.problems = append(v.problems, Problem{Path: path, Message: fmt.Sprintf(format, args...), Warning: true})
+}
+
+// Validate checks cfg for values that are invalid or would cause roles to be assigned incorrectly,
+// and returns every problem found.
+func (cfg *ConfigFile) Validate() []Problem {
+	v := &validator{}
+
+	if !IsSnowflake(cfg.BotChannelId) {
+		v.errorf("bot_channel_id", "%q is not a valid channel ID", cfg.BotChannelId)
+	}
+	if cfg.ModLogChannelId != "" && !IsSnowflake(cfg.ModLogChannelId) {
+		v.errorf("mod_log_channel_id", "%q is not a valid channel ID", cfg.ModLogChannelId)
+	}
+	if cfg.CommandPrefix == "" && !cfg.MentionPrefix {
+		v.errorf("command_prefix", "must be set unless mention_prefix is enabled")
+	}
+	if !locale.Supported(cfg.Locale) {
+		v.errorf("locale", "unsupported locale %q, must be one of %s", cfg.Locale, strings.Join(locale.Locales(), ", "))
+	}
+	if cfg.RoleAccountRule != RoleAccountRulePrimary && cfg.RoleAccountRule != RoleAccountRuleBest {
+		v.errorf("role_account_rule", "must be %q or %q, got %q", RoleAccountRulePrimary, RoleAccountRuleBest, cfg.RoleAccountRule)
+	}
+	if cfg.StaleAfter <= 0 {
+		v.errorf("stale_after", "must be a positive duration")
+	}
+	if cfg.FailureThreshold < 1 {
+		v.errorf("failure_threshold", "must be at least 1")
+	}
+	if cfg.RatingCacheTTL <= 0 {
+		v.errorf("rating_cache_ttl", "must be a positive duration")
+	}
+	if _, err := cron.ParseStandard(cfg.DigestSchedule); err != nil {
+		v.errorf("digest_schedule", "invalid cron schedule: %v", err)
+	}
+	if cfg.DigestSize < 1 {
+		v.errorf("digest_size", "must be at least 1")
+	}
+	if cfg.ShardCount < 1 {
+		v.errorf("shard_count", "must be at least 1")
+	}
+	shardIds := make(map[int]bool, len(cfg.ShardIds))
+	for i, shardId := range cfg.ShardIds {
+		path := fmt.Sprintf("shard_ids[%d]", i)
+		if shardId < 0 || shardId >= cfg.ShardCount {
+			v.errorf(path, "%d is not between 0 and shard_count - 1", shardId)
+		}
+		if shardIds[shardId] {
+			v.errorf(path, "duplicate shard ID %d", shardId)
+		}
+		shardIds[shardId] = true
+	}
+	for i, roleId := range cfg.AdminRoles {
+		if !IsSnowflake(roleId) {
+			v.errorf(fmt.Sprintf("admin_roles[%d]", i), "%q is not a valid role ID", roleId)
+		}
+	}
+
+	var enabled bool
+	for i, eloType := range cfg.EloTypes {
+		enabled = enabled || eloType.Enabled
+		v.validateEloType(EloTypeKeys[i], eloType)
+	}
+	if !enabled {
+		v.warnf("", "no Elo types are enabled")
+	}
+
+	return v.problems
+}
+
+func (v *validator) validateEloType(path string, eloType EloType) {
+	if !eloType.Enabled {
+		if len(eloType.Roles) != 0 || eloType.Preset != "" {
+			v.warnf(path, "roles are configured but the Elo type is not enabled")
+		}
+		return
+	}
+
+	if eloType.Preset != "" {
+		if !eloType.presetExpanded {
+			if _, ok := presets[eloType.Preset]; !ok {
+				v.errorf(path+".preset", "unknown preset %q", eloType.Preset)
+			} else {
+				v.errorf(path+".preset", "cannot set both preset and roles")
+			}
+		}
+		for name := range eloType.PresetRoleIds {
+			if !presetHasRole(eloType.Preset, name) {
+				v.errorf(path+".preset_role_ids."+name, "%q is not a role of preset %q", name, eloType.Preset)
+			}
+		}
+	} else if len(eloType.PresetRoleIds) != 0 {
+		v.warnf(path+".preset_role_ids", "ignored because no preset is set")
+	}
+
+	if eloType.InactiveAfter < 0 {
+		v.errorf(path+".inactive_after", "must not be negative")
+	}
+	if eloType.InactiveRoleId != "" {
+		if !IsSnowflake(eloType.InactiveRoleId) {
+			v.errorf(path+".inactive_role_id", "%q is not a valid role ID", eloType.InactiveRoleId)
+		}
+		if eloType.InactiveAfter == 0 {
+			v.warnf(path+".inactive_role_id", "ignored because inactive_after is not set")
+		}
+	}
+
+	rolesPath := path + ".roles"
+	if eloType.presetExpanded {
+		rolesPath = path + ".preset"
+	}
+	v.validateRoles(rolesPath, eloType)
+}
+
+func (v *validator) validateRoles(path string, eloType EloType) {
+	roleIds := make(map[string]string)
+	names := make(map[string]string)
+	priorities := make(map[int16]string)
+	if eloType.InactiveRoleId != "" {
+		roleIds[eloType.InactiveRoleId] = path + ".inactive_role_id"
+	}
+
+	rolePaths := make([]string, len(eloType.Roles))
+	for i, role := range eloType.Roles {
+		rolePath := fmt.Sprintf("%s[%d]", path, i)
+		if eloType.presetExpanded {
+			rolePath = fmt.Sprintf("%s(%s)", path, role.Name)
+		}
+		rolePaths[i] = rolePath
+
+		switch {
+		case role.RoleId == "" && role.Name == "":
+			v.errorf(rolePath, "either role_id or name must be set")
+		case role.RoleId != "" && !IsSnowflake(role.RoleId):
+			v.errorf(rolePath+".role_id", "%q is not a valid role ID", role.RoleId)
+		case role.RoleId != "":
+			if other, ok := roleIds[role.RoleId]; ok {
+				v.errorf(rolePath+".role_id", "role ID %s is also used by %s", role.RoleId, other)
+			}
+			roleIds[role.RoleId] = rolePath
+		}
+
+		if role.Name != "" {
+			if other, ok := names[role.Name]; ok {
+				v.errorf(rolePath+".name", "name %q is also used by %s", role.Name, other)
+			}
+			names[role.Name] = rolePath
+		} else if eloType.UseReportedLeague {
+			v.warnf(rolePath, "role has no name, so it cannot be matched to a reported league")
+		}
+
+		if role.Color != "" && role.ColorValue() == 0 && strings.Trim(role.Color, "#0") != "" {
+			v.errorf(rolePath+".color", "%q is not a valid hex color", role.Color)
+		}
+
+		if other, ok := priorities[role.RolePriority]; ok {
+			v.errorf(rolePath+".role_priority", "priority %d is also used by %s", role.RolePriority, other)
+		}
+		priorities[role.RolePriority] = rolePath
+		if role.RolePriority >= InactiveRolePriority {
+			v.errorf(rolePath+".role_priority", "must be less than %d", InactiveRolePriority)
+		}
+
+		if role.StartingElo > role.EndingElo {
+			v.errorf(rolePath, "starting_elo %d is greater than ending_elo %d", role.StartingElo, role.EndingElo)
+		}
+	}
+
+	order := make([]int, len(eloType.Roles))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return eloType.Roles[order[a]].StartingElo < eloType.Roles[order[b]].StartingElo
+	})
+
+	for i := 1; i < len(order); i++ {
+		prev, cur := eloType.Roles[order[i-1]], eloType.Roles[order[i]]
+		prevPath, curPath := rolePaths[order[i-1]], rolePaths[order[i]]
+		switch {
+		case cur.StartingElo <= prev.EndingElo:
+			v.errorf(curPath, "Elo range %d-%d overlaps with %s (%d-%d)",
+				cur.StartingElo, cur.EndingElo, prevPath, prev.StartingElo, prev.EndingElo)
+		case int(cur.StartingElo) > int(prev.EndingElo)+1:
+			v.warnf(curPath, "gap in Elo ranges between %d and %d, members in it get no role",
+				prev.EndingElo, cur.StartingElo)
+		}
+
+		if cur.StartingElo > prev.EndingElo && cur.RolePriority > prev.RolePriority {
+			v.warnf(curPath, "role_priority %d ranks it below %s (%d) despite its higher Elo range",
+				cur.RolePriority, prevPath, prev.RolePriority)
+		}
+	}
+}
+
+// IsSnowflake reports whether id has the format of a Discord ID.
+func IsSnowflake(id string) bool {
+	if len(id) < 17 || len(id) > 20 {
+		return false
+	}
+	for _, r := range id {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
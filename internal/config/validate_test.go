@@ -0,0 +1,265 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func validConfig() *ConfigFile {
+	cfg := &ConfigFile{
+		BotChannelId:     "100000000000000001",
+		CommandPrefix:    "!",
+		Locale:           "en",
+		RoleAccountRule:  RoleAccountRuleBest,
+		StaleAfter:       time.Hour,
+		FailureThreshold: 3,
+		RatingCacheTTL:   5 * time.Minute,
+		DigestSchedule:   "0 18 * * 0",
+		DigestSize:       5,
+		ShardCount:       1,
+		AdminRoles:       []string{"100000000000000002"},
+		OneVOne: EloType{
+			Enabled: true,
+			Roles: []EloRole{
+				{Name: "Low", RoleId: "100000000000000003", RolePriority: 20, StartingElo: 0, EndingElo: 999},
+				{Name: "High", RoleId: "100000000000000004", RolePriority: 10, StartingElo: 1000, EndingElo: 32767},
+			},
+		},
+	}
+	cfg.EloTypes = []EloType{cfg.OneVOne, cfg.TwoVTwo, cfg.ThreeVThree, cfg.FourVFour, cfg.Custom}
+
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		modify   func(cfg *ConfigFile)
+		errors   []string
+		warnings []string
+	}{
+		{
+			name:   "valid",
+			modify: func(cfg *ConfigFile) {},
+		},
+		{
+			name:   "invalid bot channel",
+			modify: func(cfg *ConfigFile) { cfg.BotChannelId = "botChannelId" },
+			errors: []string{"bot_channel_id"},
+		},
+		{
+			name:   "invalid mod log channel",
+			modify: func(cfg *ConfigFile) { cfg.ModLogChannelId = "123" },
+			errors: []string{"mod_log_channel_id"},
+		},
+		{
+			name:   "empty prefix",
+			modify: func(cfg *ConfigFile) { cfg.CommandPrefix = "" },
+			errors: []string{"command_prefix"},
+		},
+		{
+			name: "empty prefix with mention prefix",
+			modify: func(cfg *ConfigFile) {
+				cfg.CommandPrefix = ""
+				cfg.MentionPrefix = true
+			},
+		},
+		{
+			name:   "unsupported locale",
+			modify: func(cfg *ConfigFile) { cfg.Locale = "xx" },
+			errors: []string{"locale"},
+		},
+		{
+			name:   "unknown role account rule",
+			modify: func(cfg *ConfigFile) { cfg.RoleAccountRule = "worst" },
+			errors: []string{"role_account_rule"},
+		},
+		{
+			name: "non-positive durations and counts",
+			modify: func(cfg *ConfigFile) {
+				cfg.StaleAfter = 0
+				cfg.FailureThreshold = 0
+				cfg.RatingCacheTTL = -time.Second
+				cfg.DigestSize = 0
+			},
+			errors: []string{"stale_after", "failure_threshold", "rating_cache_ttl", "digest_size"},
+		},
+		{
+			name:   "invalid digest schedule",
+			modify: func(cfg *ConfigFile) { cfg.DigestSchedule = "every sunday" },
+			errors: []string{"digest_schedule"},
+		},
+		{
+			name: "shard IDs out of range and duplicated",
+			modify: func(cfg *ConfigFile) {
+				cfg.ShardCount = 2
+				cfg.ShardIds = []int{1, 2, 1}
+			},
+			errors: []string{"shard_ids[1]", "shard_ids[2]"},
+		},
+		{
+			name:   "zero shard count",
+			modify: func(cfg *ConfigFile) { cfg.ShardCount = 0 },
+			errors: []string{"shard_count"},
+		},
+		{
+			name:   "invalid admin role",
+			modify: func(cfg *ConfigFile) { cfg.AdminRoles = append(cfg.AdminRoles, "adminRoleId") },
+			errors: []string{"admin_roles[1]"},
+		},
+		{
+			name:     "no enabled Elo types",
+			modify:   func(cfg *ConfigFile) { cfg.EloTypes[0].Enabled = false },
+			warnings: []string{"1v1", ""},
+		},
+		{
+			name: "role without ID or name",
+			modify: func(cfg *ConfigFile) {
+				cfg.EloTypes[0].Roles[0].Name = ""
+				cfg.EloTypes[0].Roles[0].RoleId = ""
+			},
+			errors: []string{"1v1.roles[0]"},
+		},
+		{
+			name: "duplicate role ID, name and priority",
+			modify: func(cfg *ConfigFile) {
+				cfg.EloTypes[0].Roles[1].RoleId = cfg.EloTypes[0].Roles[0].RoleId
+				cfg.EloTypes[0].Roles[1].Name = cfg.EloTypes[0].Roles[0].Name
+				cfg.EloTypes[0].Roles[1].RolePriority = cfg.EloTypes[0].Roles[0].RolePriority
+			},
+			errors: []string{"1v1.roles[1].role_id", "1v1.roles[1].name", "1v1.roles[1].role_priority"},
+		},
+		{
+			name:   "priority of the inactive role",
+			modify: func(cfg *ConfigFile) { cfg.EloTypes[0].Roles[0].RolePriority = InactiveRolePriority },
+			errors: []string{"1v1.roles[0].role_priority"},
+		},
+		{
+			name:   "invalid color",
+			modify: func(cfg *ConfigFile) { cfg.EloTypes[0].Roles[0].Color = "#zzzzzz" },
+			errors: []string{"1v1.roles[0].color"},
+		},
+		{
+			name:   "starting Elo above ending Elo",
+			modify: func(cfg *ConfigFile) { cfg.EloTypes[0].Roles[1].EndingElo = 500 },
+			errors: []string{"1v1.roles[1]"},
+		},
+		{
+			name:   "overlapping ranges",
+			modify: func(cfg *ConfigFile) { cfg.EloTypes[0].Roles[1].StartingElo = 900 },
+			errors: []string{"1v1.roles[1]"},
+		},
+		{
+			name:     "gap between ranges",
+			modify:   func(cfg *ConfigFile) { cfg.EloTypes[0].Roles[1].StartingElo = 1100 },
+			warnings: []string{"1v1.roles[1]"},
+		},
+		{
+			name:     "higher range ranked lower",
+			modify:   func(cfg *ConfigFile) { cfg.EloTypes[0].Roles[1].RolePriority = 30 },
+			warnings: []string{"1v1.roles[1]"},
+		},
+		{
+			name: "inactive role without inactive_after",
+			modify: func(cfg *ConfigFile) {
+				cfg.EloTypes[0].InactiveRoleId = "100000000000000005"
+			},
+			warnings: []string{"1v1.inactive_role_id"},
+		},
+		{
+			name: "inactive role reusing an Elo role",
+			modify: func(cfg *ConfigFile) {
+				cfg.EloTypes[0].InactiveAfter = 24 * time.Hour
+				cfg.EloTypes[0].InactiveRoleId = cfg.EloTypes[0].Roles[0].RoleId
+			},
+			errors: []string{"1v1.roles[0].role_id"},
+		},
+		{
+			name: "unknown preset",
+			modify: func(cfg *ConfigFile) {
+				cfg.EloTypes[0].Roles = nil
+				cfg.EloTypes[0].Preset = "unknown"
+			},
+			errors: []string{"1v1.preset"},
+		},
+		{
+			name:   "preset with roles",
+			modify: func(cfg *ConfigFile) { cfg.EloTypes[0].Preset = PresetRankedLeagues },
+			errors: []string{"1v1.preset"},
+		},
+		{
+			name: "expanded preset",
+			modify: func(cfg *ConfigFile) {
+				cfg.EloTypes[0].Roles = nil
+				cfg.EloTypes[0].Preset = PresetRankedLeagues
+				cfg.EloTypes[0].PresetRoleIds = map[string]string{"Gold I": "100000000000000006"}
+				cfg.EloTypes[0].expandPreset()
+			},
+		},
+		{
+			name: "preset role ID for an unknown role",
+			modify: func(cfg *ConfigFile) {
+				cfg.EloTypes[0].Roles = nil
+				cfg.EloTypes[0].Preset = PresetRankedLeagues
+				cfg.EloTypes[0].PresetRoleIds = map[string]string{"Gold IV": "100000000000000006"}
+				cfg.EloTypes[0].expandPreset()
+			},
+			errors: []string{"1v1.preset_role_ids.Gold IV"},
+		},
+		{
+			name: "preset role IDs without a preset",
+			modify: func(cfg *ConfigFile) {
+				cfg.EloTypes[0].PresetRoleIds = map[string]string{"Gold I": "100000000000000006"}
+			},
+			warnings: []string{"1v1.preset_role_ids"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.modify(cfg)
+
+			var errors, warnings []string
+			for _, p := range cfg.Validate() {
+				if p.Warning {
+					warnings = append(warnings, p.Path)
+				} else {
+					errors = append(errors, p.Path)
+				}
+			}
+
+			if !reflect.DeepEqual(errors, tt.errors) {
+				t.Errorf("errors = %q, want %q", errors, tt.errors)
+			}
+			if !reflect.DeepEqual(warnings, tt.warnings) {
+				t.Errorf("warnings = %q, want %q", warnings, tt.warnings)
+			}
+			if got, want := HasErrors(cfg.Validate()), len(tt.errors) != 0; got != want {
+				t.Errorf("HasErrors() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestIsSnowflake(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"100000000000000001", true},
+		{"12345678901234567", true},
+		{"12345678901234567890", true},
+		{"1234567890123456", false},
+		{"123456789012345678901", false},
+		{"10000000000000000a", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsSnowflake(tt.id); got != tt.want {
+			t.Errorf("IsSnowflake(%q) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+}
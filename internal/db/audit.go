@@ -0,0 +1,104 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgtype"
+)
+
+// Audited actions.
+const (
+	AuditLink       = "link"
+	AuditUnlink     = "unlink"
+	AuditPrimary    = "primary"
+	AuditOptIn      = "optin"
+	AuditOptOut     = "optout"
+	AuditVisibility = "visibility"
+	AuditImport     = "import"
+	AuditRoleChange = "role_change"
+)
+
+// An AuditEntry records a change to a registration or Elo role.
+type AuditEntry struct {
+	GuildID string
+	// ActorID is the ID of the user who made the change, or an empty string for changes made by the bot.
+	ActorID  string
+	TargetID string
+	Action   string
+	OldValue string
+	NewValue string
+	// CreatedAt is set by AddAuditEntry.
+	CreatedAt time.Time
+}
+
+// AddAuditEntry stores e in the audit log.
+func AddAuditEntry(e AuditEntry) error {
+	if _, err := Db.Exec(context.Background(),
+		`insert into audit_log(guild_id, actor_id, target_id, action, old_value, new_value)
+		 values($1, $2, $3, $4, $5, $6)`,
+		e.GuildID, nullText(e.ActorID), e.TargetID, e.Action, nullText(e.OldValue), nullText(e.NewValue)); err != nil {
+		return fmt.Errorf("error adding audit entry: %w", err)
+	}
+
+	return nil
+}
+
+// GetAuditEntries returns the limit most recent audit entries on the guild specified by guildId, newest first.
+// If targetId is not empty, only entries for that user are returned.
+func GetAuditEntries(guildId string, targetId string, limit int) ([]AuditEntry, error) {
+	rows, err := Db.Query(context.Background(),
+		`select guild_id, actor_id, target_id, action, old_value, new_value, created_at from audit_log
+		 where guild_id = $1 and ($2 = '' or target_id = $2)
+		 order by created_at desc, id desc
+		 limit $3`,
+		guildId, targetId, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error getting audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		var actorId, oldValue, newValue pgtype.Text
+		if err := rows.Scan(&e.GuildID, &actorId, &e.TargetID, &e.Action, &oldValue, &newValue, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning audit entry: %w", err)
+		}
+		e.ActorID, e.OldValue, e.NewValue = actorId.String, oldValue.String, newValue.String
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+// GetRoleChanges returns the last time each role was added to or removed from the member specified by targetId
+// on the guild specified by guildId, according to the audit log.
+func GetRoleChanges(guildId string, targetId string) (map[string]time.Time, error) {
+	rows, err := Db.Query(context.Background(),
+		`select role_id, max(created_at) from (
+		 select old_value as role_id, created_at from audit_log
+		 where guild_id = $1 and target_id = $2 and action = $3 and old_value is not null
+		 union all
+		 select new_value, created_at from audit_log
+		 where guild_id = $1 and target_id = $2 and action = $3 and new_value is not null
+		 ) changes group by role_id`,
+		guildId, targetId, AuditRoleChange)
+	if err != nil {
+		return nil, fmt.Errorf("error getting role changes: %w", err)
+	}
+	defer rows.Close()
+
+	changes := make(map[string]time.Time)
+	for rows.Next() {
+		var roleId string
+		var changedAt time.Time
+		if err := rows.Scan(&roleId, &changedAt); err != nil {
+			return nil, fmt.Errorf("error scanning role change: %w", err)
+		}
+		changes[roleId] = changedAt
+	}
+
+	return changes, rows.Err()
+}
@@ -2,11 +2,13 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 
 	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/config"
 	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
@@ -14,8 +16,12 @@ type User struct {
 	DiscordUserID string
 	Aoe4Username  string
 	Aoe4Id        string
+	IsPrimary     bool
 	CurrentElo    userElo
 	NewElo        userElo
+	Status        [len(Modes)]RatingStatus
+	League        [len(Modes)]string
+	Stats         [len(Modes)]PlayerStats
 }
 
 type userElo struct {
@@ -26,90 +32,484 @@ type userElo struct {
 	Custom      int16
 }
 
+type GuildSettings struct {
+	Prefix        string
+	MentionPrefix bool
+	Locale        string
+	// DigestChannelId is the channel the weekly digest is posted to, DigestOff if it is not posted,
+	// or an empty string for the default channel.
+	DigestChannelId string
+}
+
 var Db *pgxpool.Pool
 
-func init() {
-	// Open connection to user database
+// DigestOff is the digest channel of guilds that do not receive the weekly digest.
+const DigestOff = "off"
+
+// ErrAccountNotFound is returned when no linked AOE4 account matches a query.
+var ErrAccountNotFound = errors.New("account not found")
+
+// ErrNotInGuild is returned when a user has not opted in to Elo tracking on a guild.
+var ErrNotInGuild = errors.New("user has not opted in to guild")
+
+// migrations holds the database schema changes in the order they are applied.
+// New changes must be appended to the end of the slice.
+var migrations = []string{
+	`create table if not exists users(
+	 discord_id	varchar(20),
+	 username	text not null,
+	 guild_id	varchar(20),
+	 aoe_id		varchar(40) not null,
+	 elo_1v1	smallint,
+	 elo_2v2	smallint,
+	 elo_3v3	smallint,
+	 elo_4v4	smallint,
+	 elo_custom	smallint,
+	 primary key(discord_id, guild_id)
+	 )`,
+	`create table if not exists guilds(
+	 guild_id		varchar(20) primary key,
+	 prefix			text,
+	 mention_prefix	boolean
+	 )`,
+	`alter table guilds add column locale text;
+	 create table user_settings(
+	 discord_id	varchar(20) primary key,
+	 locale		text
+	 )`,
+	`alter table users add column is_primary boolean not null default true;
+	 alter table users drop constraint users_pkey;
+	 alter table users add primary key(discord_id, guild_id, aoe_id)`,
+	`create table accounts(
+	 discord_id	varchar(20),
+	 aoe_id		varchar(40),
+	 username	text not null,
+	 is_primary	boolean not null default true,
+	 elo_1v1	smallint,
+	 elo_2v2	smallint,
+	 elo_3v3	smallint,
+	 elo_4v4	smallint,
+	 elo_custom	smallint,
+	 primary key(discord_id, aoe_id)
+	 );
+	 insert into accounts(discord_id, aoe_id, username, is_primary, elo_1v1, elo_2v2, elo_3v3, elo_4v4, elo_custom)
+	 select distinct on (discord_id, aoe_id)
+	 discord_id, aoe_id, username, is_primary, elo_1v1, elo_2v2, elo_3v3, elo_4v4, elo_custom
+	 from users order by discord_id, aoe_id, is_primary desc;
+	 update accounts a set is_primary = (aoe_id = (
+	 select aoe_id from accounts b where b.discord_id = a.discord_id order by is_primary desc, aoe_id limit 1));
+	 create table guild_users(
+	 discord_id	varchar(20),
+	 guild_id	varchar(20),
+	 visible	boolean not null default true,
+	 primary key(discord_id, guild_id)
+	 );
+	 insert into guild_users(discord_id, guild_id) select distinct discord_id, guild_id from users;
+	 drop table users`,
+	`create table ratings(
+	 aoe_id		varchar(40),
+	 mode		varchar(10),
+	 elo		smallint,
+	 fetched_at	timestamptz,
+	 last_error	text,
+	 error_at	timestamptz,
+	 failures	integer not null default 0,
+	 primary key(aoe_id, mode)
+	 );
+	 insert into ratings(aoe_id, mode, elo)
+	 select distinct on (aoe_id, mode) aoe_id, mode, elo from (
+	 select aoe_id, '1v1' as mode, elo_1v1 as elo from accounts union all
+	 select aoe_id, '2v2', elo_2v2 from accounts union all
+	 select aoe_id, '3v3', elo_3v3 from accounts union all
+	 select aoe_id, '4v4', elo_4v4 from accounts union all
+	 select aoe_id, 'custom', elo_custom from accounts
+	 ) elos where elo is not null;
+	 alter table accounts
+	 drop column elo_1v1, drop column elo_2v2, drop column elo_3v3, drop column elo_4v4, drop column elo_custom`,
+	`alter table ratings add column changed_at timestamptz;
+	 update ratings set changed_at = now() where elo is not null`,
+	`alter table ratings add column league text`,
+	`create table guild_roles(
+	 guild_id	varchar(20),
+	 mode		varchar(10),
+	 name		text,
+	 role_id	varchar(20) not null,
+	 primary key(guild_id, mode, name)
+	 )`,
+	`create table audit_log(
+	 id			bigserial primary key,
+	 guild_id	varchar(20) not null,
+	 actor_id	varchar(20),
+	 target_id	varchar(20) not null,
+	 action		text not null,
+	 old_value	text,
+	 new_value	text,
+	 created_at	timestamptz not null default now()
+	 );
+	 create index audit_log_guild_target on audit_log(guild_id, target_id, created_at)`,
+	`create table command_permissions(
+	 guild_id	varchar(20),
+	 command	text,
+	 rule		text,
+	 value		text not null default '',
+	 primary key(guild_id, command, rule, value)
+	 )`,
+	`alter table ratings
+	 add column rank integer,
+	 add column wins integer,
+	 add column losses integer,
+	 add column win_rate real,
+	 add column win_streak integer,
+	 add column last_played timestamptz`,
+	`create table rating_history(
+	 aoe_id			varchar(40),
+	 mode			varchar(10),
+	 elo			smallint not null,
+	 recorded_at	timestamptz not null default now(),
+	 primary key(aoe_id, mode, recorded_at)
+	 );
+	 insert into rating_history(aoe_id, mode, elo, recorded_at)
+	 select aoe_id, mode, elo, coalesce(changed_at, now()) from ratings where elo is not null`,
+	`alter table guilds add column digest_channel_id varchar(20)`,
+}
+
+// Connect opens a connection pool to the database specified by url.
+func Connect(ctx context.Context, url string) (*pgxpool.Pool, error) {
+	pool, err := pgxpool.Connect(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to database: %w", err)
+	}
+
+	return pool, nil
+}
+
+// Migrate applies all pending migrations to Db.
+func Migrate(ctx context.Context) error {
+	if _, err := Db.Exec(ctx, "create table if not exists schema_version(version integer not null)"); err != nil {
+		return fmt.Errorf("error creating schema_version table: %w", err)
+	}
+
+	var version int
+	if err := Db.QueryRow(ctx, "select coalesce(max(version), 0) from schema_version").Scan(&version); err != nil {
+		return fmt.Errorf("error getting schema version: %w", err)
+	}
+
+	for ; version < len(migrations); version++ {
+		if err := applyMigration(ctx, version); err != nil {
+			return err
+		}
+		log.Printf("applied database migration %d", version+1)
+	}
+
+	return nil
+}
+
+// CheckSchema returns an error if migrations are pending on Db, without applying them.
+func CheckSchema(ctx context.Context) error {
+	var version int
+	if err := Db.QueryRow(ctx, "select coalesce(max(version), 0) from schema_version").Scan(&version); err != nil {
+		return fmt.Errorf("error getting schema version, the database may need to be migrated: %w", err)
+	}
+	if version < len(migrations) {
+		return fmt.Errorf("database schema version %d is out of date, run migrate to upgrade it to %d",
+			version, len(migrations))
+	}
+
+	return nil
+}
+
+func applyMigration(ctx context.Context, version int) error {
+	tx, err := Db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error starting migration transaction: %w", err)
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	if _, err := tx.Exec(ctx, migrations[version]); err != nil {
+		return fmt.Errorf("error applying migration %d: %w", version+1, err)
+	}
+	if _, err := tx.Exec(ctx, "delete from schema_version"); err != nil {
+		return fmt.Errorf("error clearing schema version: %w", err)
+	}
+	if _, err := tx.Exec(ctx, "insert into schema_version(version) values($1)", version+1); err != nil {
+		return fmt.Errorf("error setting schema version: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("error committing migration %d: %w", version+1, err)
+	}
+
+	return nil
+}
+
+// GetGuildSettings returns the settings for the guild specified by guildId,
+// falling back to the values in the config file for settings that are not set.
+func GetGuildSettings(guildId string) (*GuildSettings, error) {
+	cfg := config.Get()
+	gs := &GuildSettings{
+		Prefix:        cfg.CommandPrefix,
+		MentionPrefix: cfg.MentionPrefix,
+		Locale:        cfg.Locale,
+	}
+
+	var prefix, locale, digestChannelId pgtype.Text
+	var mentionPrefix pgtype.Bool
+	err := Db.QueryRow(context.Background(),
+		"select prefix, mention_prefix, locale, digest_channel_id from guilds where guild_id = $1", guildId).
+		Scan(&prefix, &mentionPrefix, &locale, &digestChannelId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return gs, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error getting guild settings: %w", err)
+	}
+
+	if prefix.Status == pgtype.Present {
+		gs.Prefix = prefix.String
+	}
+	if mentionPrefix.Status == pgtype.Present {
+		gs.MentionPrefix = mentionPrefix.Bool
+	}
+	if locale.Status == pgtype.Present {
+		gs.Locale = locale.String
+	}
+	gs.DigestChannelId = digestChannelId.String
+
+	return gs, nil
+}
+
+func SetGuildPrefix(guildId string, prefix string) error {
+	if _, err := Db.Exec(context.Background(),
+		`insert into guilds(guild_id, prefix) values($1, $2)
+		 on conflict (guild_id) do update set prefix = excluded.prefix`,
+		guildId, prefix); err != nil {
+		return fmt.Errorf("error setting guild prefix in db: %w", err)
+	}
+
+	return nil
+}
+
+func SetGuildMentionPrefix(guildId string, mentionPrefix bool) error {
+	if _, err := Db.Exec(context.Background(),
+		`insert into guilds(guild_id, mention_prefix) values($1, $2)
+		 on conflict (guild_id) do update set mention_prefix = excluded.mention_prefix`,
+		guildId, mentionPrefix); err != nil {
+		return fmt.Errorf("error setting guild mention prefix in db: %w", err)
+	}
+
+	return nil
+}
+
+func SetGuildLocale(guildId string, locale string) error {
+	if _, err := Db.Exec(context.Background(),
+		`insert into guilds(guild_id, locale) values($1, $2)
+		 on conflict (guild_id) do update set locale = excluded.locale`,
+		guildId, locale); err != nil {
+		return fmt.Errorf("error setting guild locale in db: %w", err)
+	}
+
+	return nil
+}
+
+// GetUserLocale returns the locale chosen by the user specified by discordId,
+// or an empty string if the user has not chosen one.
+func GetUserLocale(discordId string) (string, error) {
+	var locale pgtype.Text
+	err := Db.QueryRow(context.Background(),
+		"select locale from user_settings where discord_id = $1", discordId).
+		Scan(&locale)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("error getting user locale: %w", err)
+	}
+
+	return locale.String, nil
+}
+
+// SetUserLocale sets the locale for the user specified by discordId.
+// An empty locale resets the user to the guild default.
+func SetUserLocale(discordId string, locale string) error {
 	var err error
-	if Db, err = pgxpool.Connect(context.Background(), config.Cfg.DbUrl); err != nil {
-		log.Fatalf("error connecting to database: %v\n", err)
+	if locale == "" {
+		_, err = Db.Exec(context.Background(),
+			"delete from user_settings where discord_id = $1", discordId)
+	} else {
+		_, err = Db.Exec(context.Background(),
+			`insert into user_settings(discord_id, locale) values($1, $2)
+			 on conflict (discord_id) do update set locale = excluded.locale`,
+			discordId, locale)
+	}
+	if err != nil {
+		return fmt.Errorf("error setting user locale in db: %w", err)
 	}
 
+	return nil
+}
+
+// LinkAccount links the AOE4 account specified by aoeId to the Discord user specified by discordId,
+// updating the username if the account is already linked. The first account linked by a user becomes
+// their primary account.
+func LinkAccount(username string, aoeId string, discordId string) error {
 	if _, err := Db.Exec(context.Background(),
-		`create table if not exists users(
-		 discord_id	varchar(20),
-		 username	text not null,
-		 guild_id	varchar(20),
-		 aoe_id		varchar(40) not null,
-		 elo_1v1	smallint,
-		 elo_2v2	smallint,
-		 elo_3v3	smallint,
-		 elo_4v4	smallint,
-		 elo_custom	smallint,
-		 primary key(discord_id, guild_id)
-		 )`); err != nil {
-		log.Fatalf("error setting up database: %v\n", err)
-	}
-}
-
-func RegisterUser(username string, aoeId string, discordId string, guildId string) error {
+		`insert into accounts(username, aoe_id, discord_id, is_primary)
+		 values($1, $2, $3, not exists(select 1 from accounts where discord_id = $3))
+		 on conflict (discord_id, aoe_id) do update set username = excluded.username`,
+		username, aoeId, discordId); err != nil {
+		return fmt.Errorf("error linking account in db: %w", err)
+	}
+
+	return nil
+}
+
+// UnlinkAccount removes the AOE4 account specified by aoeId from the Discord user specified by discordId.
+// If the account was the user's primary account, another linked account becomes primary.
+func UnlinkAccount(discordId string, aoeId string) error {
+	tx, err := Db.Begin(context.Background())
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(context.Background()) //nolint:errcheck
+
+	var wasPrimary bool
+	if err := tx.QueryRow(context.Background(),
+		"delete from accounts where discord_id = $1 and aoe_id = $2 returning is_primary",
+		discordId, aoeId).Scan(&wasPrimary); errors.Is(err, pgx.ErrNoRows) {
+		return ErrAccountNotFound
+	} else if err != nil {
+		return fmt.Errorf("error unlinking account in db: %w", err)
+	}
+
+	if wasPrimary {
+		if _, err := tx.Exec(context.Background(),
+			`update accounts set is_primary = true
+			 where discord_id = $1 and aoe_id = (select min(aoe_id) from accounts where discord_id = $1)`,
+			discordId); err != nil {
+			return fmt.Errorf("error setting primary account in db: %w", err)
+		}
+	}
+
+	if err := tx.Commit(context.Background()); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+// SetPrimaryAccount marks the AOE4 account specified by aoeId as the primary account
+// of the Discord user specified by discordId.
+func SetPrimaryAccount(discordId string, aoeId string) error {
 	updateUser, err := Db.Exec(context.Background(),
-		"update users set username = $1, aoe_id = $2 where discord_id = $3 and guild_id = $4",
-		username, aoeId, discordId, guildId)
+		`update accounts set is_primary = (aoe_id = $2) where discord_id = $1
+		 and exists(select 1 from accounts where discord_id = $1 and aoe_id = $2)`,
+		discordId, aoeId)
 	if err != nil {
-		return fmt.Errorf("error updating user in db: %w", err)
+		return fmt.Errorf("error setting primary account in db: %w", err)
 	}
 	if updateUser.RowsAffected() == 0 {
-		if _, err := Db.Exec(context.Background(),
-			"insert into users(username, aoe_id, discord_id, guild_id) values($1, $2, $3, $4)",
-			username, aoeId, discordId, guildId); err != nil {
-			return fmt.Errorf("error inserting user in db: %w", err)
-		}
+		return ErrAccountNotFound
 	}
 
 	return nil
 }
 
-func UpdateUserElo(discordId string, guildId string, elo userElo) error {
+// JoinGuild opts the Discord user specified by discordId in to Elo tracking on the guild specified by guildId.
+func JoinGuild(discordId string, guildId string) error {
+	if _, err := Db.Exec(context.Background(),
+		"insert into guild_users(discord_id, guild_id) values($1, $2) on conflict do nothing",
+		discordId, guildId); err != nil {
+		return fmt.Errorf("error adding user to guild in db: %w", err)
+	}
+
+	return nil
+}
+
+// LeaveGuild opts the Discord user specified by discordId out of Elo tracking on the guild specified by guildId.
+func LeaveGuild(discordId string, guildId string) error {
+	leaveGuild, err := Db.Exec(context.Background(),
+		"delete from guild_users where discord_id = $1 and guild_id = $2",
+		discordId, guildId)
+	if err != nil {
+		return fmt.Errorf("error removing user from guild in db: %w", err)
+	}
+	if leaveGuild.RowsAffected() == 0 {
+		return ErrNotInGuild
+	}
+
+	return nil
+}
+
+// SetGuildDigestChannel sets the channel the weekly digest of the guild is posted to,
+// which is DigestOff to stop posting it, or an empty string for the default channel.
+func SetGuildDigestChannel(guildId string, channelId string) error {
+	if _, err := Db.Exec(context.Background(),
+		`insert into guilds(guild_id, digest_channel_id) values($1, $2)
+		 on conflict (guild_id) do update set digest_channel_id = excluded.digest_channel_id`,
+		guildId, nullText(channelId)); err != nil {
+		return fmt.Errorf("error setting guild digest channel in db: %w", err)
+	}
+
+	return nil
+}
+
+// SetGuildVisibility sets whether the Elo info of the Discord user specified by discordId
+// can be seen by other members of the guild specified by guildId.
+func SetGuildVisibility(discordId string, guildId string, visible bool) error {
 	updateUser, err := Db.Exec(context.Background(),
-		`update users set elo_1v1 = $1, elo_2v2 = $2, elo_3v3 = $3, elo_4v4 = $4, elo_custom = $5
-		 where discord_id = $6 and guild_id = $7`,
-		elo.OneVOne, elo.TwoVTwo, elo.ThreeVThree, elo.FourVFour, elo.Custom, discordId, guildId)
+		"update guild_users set visible = $1 where discord_id = $2 and guild_id = $3",
+		visible, discordId, guildId)
 	if err != nil {
-		return fmt.Errorf("error updating user in db: %w", err)
+		return fmt.Errorf("error setting guild visibility in db: %w", err)
 	}
-	if updateUser.RowsAffected() != 1 {
-		return fmt.Errorf("user not found")
+	if updateUser.RowsAffected() == 0 {
+		return ErrNotInGuild
 	}
 
 	return nil
 }
 
-func GetUser(discordId string, guildId string) (*User, error) {
-	row := Db.QueryRow(context.Background(), "select * from users where discord_id = $1 and guild_id = $2", discordId, guildId)
-
-	u := &User{}
-	var pgElo [5]pgtype.Int2
-	if err := row.Scan(
-		&u.DiscordUserID,
-		&u.Aoe4Username,
-		nil,
-		&u.Aoe4Id,
-		&pgElo[0],
-		&pgElo[1],
-		&pgElo[2],
-		&pgElo[3],
-		&pgElo[4]); err != nil {
+// GetGuildVisibility reports whether the Discord user specified by discordId has opted in to Elo tracking
+// on the guild specified by guildId and, if so, whether their Elo info is visible to other members.
+func GetGuildVisibility(discordId string, guildId string) (visible bool, err error) {
+	err = Db.QueryRow(context.Background(),
+		"select visible from guild_users where discord_id = $1 and guild_id = $2",
+		discordId, guildId).Scan(&visible)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, ErrNotInGuild
+	} else if err != nil {
+		return false, fmt.Errorf("error getting guild visibility: %w", err)
+	}
+
+	return visible, nil
+}
+
+// GetUser returns all accounts linked by the Discord user specified by discordId, primary account first.
+func GetUser(discordId string) ([]User, error) {
+	users, err := queryUsers(
+		"select "+userColumns+" from accounts where discord_id = $1 order by is_primary desc, aoe_id",
+		discordId)
+	if err != nil {
 		return nil, err
 	}
+	if len(users) == 0 {
+		return nil, ErrAccountNotFound
+	}
 
-	u.pgToCurrentElo(pgElo)
+	return users, nil
+}
 
-	return u, nil
+// GetUsers returns all accounts linked by users that opted in to Elo tracking on the guild specified by guildId.
+func GetUsers(guildId string) ([]User, error) {
+	return queryUsers(
+		`select `+userColumns+` from accounts
+		 join guild_users using (discord_id)
+		 where guild_id = $1
+		 order by discord_id, is_primary desc, aoe_id`,
+		guildId)
 }
 
-func GetUsers(guildId string) (users []User, err error) {
-	rows, err := Db.Query(context.Background(), "select * from users where guild_id = $1", guildId)
+const userColumns = "discord_id, username, aoe_id, is_primary"
+
+func queryUsers(sql string, args ...interface{}) (users []User, err error) {
+	rows, err := Db.Query(context.Background(), sql, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -117,43 +517,23 @@ func GetUsers(guildId string) (users []User, err error) {
 
 	for rows.Next() {
 		var u User
-		var pgElo [5]pgtype.Int2
 		if err := rows.Scan(
 			&u.DiscordUserID,
 			&u.Aoe4Username,
-			nil,
 			&u.Aoe4Id,
-			&pgElo[0],
-			&pgElo[1],
-			&pgElo[2],
-			&pgElo[3],
-			&pgElo[4]); err != nil {
+			&u.IsPrimary); err != nil {
 			return nil, err
 		}
 
-		u.pgToCurrentElo(pgElo)
-
 		users = append(users, u)
 	}
-
-	return
-}
-
-func (u *User) pgToCurrentElo(pgElo [5]pgtype.Int2) {
-	enabledAndCurrent := [...]struct {
-		enabled    bool
-		currentElo *int16
-	}{
-		{config.Cfg.OneVOne.Enabled, &u.CurrentElo.OneVOne},
-		{config.Cfg.TwoVTwo.Enabled, &u.CurrentElo.TwoVTwo},
-		{config.Cfg.ThreeVThree.Enabled, &u.CurrentElo.ThreeVThree},
-		{config.Cfg.FourVFour.Enabled, &u.CurrentElo.FourVFour},
-		{config.Cfg.Custom.Enabled, &u.CurrentElo.Custom},
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
-	for i, elo := range pgElo {
-		if enabledAndCurrent[i].enabled && elo.Status == pgtype.Present {
-			*enabledAndCurrent[i].currentElo = elo.Int
-		}
+	if err := loadRatings(users); err != nil {
+		return nil, err
 	}
+
+	return users, nil
 }
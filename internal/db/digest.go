@@ -0,0 +1,163 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/config"
+	"github.com/jackc/pgtype"
+)
+
+// A DigestRating is the rating of a linked account over the period of a digest.
+type DigestRating struct {
+	DiscordID string
+	Username  string
+	Elo       int16
+	// Change is the change of the rating over the period, which is 0 if it had no value at the start of the period.
+	Change int16
+}
+
+// A Digest summarizes the ratings and registrations of the visible members of a guild over a period.
+type Digest struct {
+	// Gainers, Losers and Top hold, for each mode, the accounts with the largest rating gains,
+	// the largest rating losses and the highest ratings, best first.
+	Gainers map[string][]DigestRating
+	Losers  map[string][]DigestRating
+	Top     map[string][]DigestRating
+	// NewRoles holds the Elo role changes that gave members a role, oldest first.
+	NewRoles []AuditEntry
+	// NewMembers holds the Discord IDs of the members that linked an account or opted in.
+	NewMembers []string
+}
+
+// GetDigest returns the digest of the guild specified by guildId for the period starting at since,
+// listing at most limit accounts for each mode enabled in cfg in each ranking. Members with a private visibility
+// are left out.
+func GetDigest(cfg *config.ConfigFile, guildId string, since time.Time, limit int) (*Digest, error) {
+	d := &Digest{
+		Gainers: make(map[string][]DigestRating),
+		Losers:  make(map[string][]DigestRating),
+		Top:     make(map[string][]DigestRating),
+	}
+
+	rows, err := Db.Query(context.Background(),
+		`select gu.discord_id, a.username, r.mode, r.elo, h.elo from guild_users gu
+		 join accounts a using (discord_id)
+		 join ratings r using (aoe_id)
+		 left join lateral (
+		 select elo from rating_history
+		 where aoe_id = r.aoe_id and mode = r.mode and recorded_at < $2
+		 order by recorded_at desc limit 1
+		 ) h on true
+		 where gu.guild_id = $1 and gu.visible and r.elo is not null`,
+		guildId, since)
+	if err != nil {
+		return nil, fmt.Errorf("error getting digest ratings: %w", err)
+	}
+	defer rows.Close()
+
+	ratings := make(map[string][]DigestRating)
+	for rows.Next() {
+		var r DigestRating
+		var mode string
+		var startElo pgtype.Int2
+		if err := rows.Scan(&r.DiscordID, &r.Username, &mode, &r.Elo, &startElo); err != nil {
+			return nil, fmt.Errorf("error scanning digest rating: %w", err)
+		}
+		if startElo.Status == pgtype.Present {
+			r.Change = r.Elo - startElo.Int
+		}
+		ratings[mode] = append(ratings[mode], r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error getting digest ratings: %w", err)
+	}
+
+	eloTypes := cfg.EloTypes
+	for i, mode := range Modes {
+		if !eloTypes[i].Enabled {
+			continue
+		}
+		d.Gainers[mode] = rankRatings(ratings[mode], limit, func(r DigestRating) int { return int(r.Change) })
+		d.Losers[mode] = rankRatings(ratings[mode], limit, func(r DigestRating) int { return -int(r.Change) })
+		d.Top[mode] = rankRatings(ratings[mode], limit, func(r DigestRating) int { return int(r.Elo) })
+	}
+
+	if d.NewRoles, err = getNewRoles(guildId, since); err != nil {
+		return nil, err
+	}
+	if d.NewMembers, err = getNewMembers(guildId, since); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// rankRatings returns at most limit of ratings with a positive score, highest score first.
+func rankRatings(ratings []DigestRating, limit int, score func(DigestRating) int) []DigestRating {
+	var ranked []DigestRating
+	for _, r := range ratings {
+		if score(r) > 0 {
+			ranked = append(ranked, r)
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return score(ranked[i]) > score(ranked[j])
+	})
+	if len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+
+	return ranked
+}
+
+func getNewRoles(guildId string, since time.Time) ([]AuditEntry, error) {
+	rows, err := Db.Query(context.Background(),
+		`select l.target_id, l.new_value, l.created_at from audit_log l
+		 join guild_users gu on gu.discord_id = l.target_id and gu.guild_id = l.guild_id
+		 where l.guild_id = $1 and l.action = $2 and l.new_value is not null and l.created_at >= $3 and gu.visible
+		 order by l.created_at, l.id`,
+		guildId, AuditRoleChange, since)
+	if err != nil {
+		return nil, fmt.Errorf("error getting new roles: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		e := AuditEntry{GuildID: guildId, Action: AuditRoleChange}
+		if err := rows.Scan(&e.TargetID, &e.NewValue, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning new role: %w", err)
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+func getNewMembers(guildId string, since time.Time) ([]string, error) {
+	rows, err := Db.Query(context.Background(),
+		`select l.target_id from audit_log l
+		 join guild_users gu on gu.discord_id = l.target_id and gu.guild_id = l.guild_id
+		 where l.guild_id = $1 and l.action = any($2) and l.created_at >= $3 and gu.visible
+		 group by l.target_id
+		 order by min(l.created_at)`,
+		guildId, []string{AuditLink, AuditOptIn}, since)
+	if err != nil {
+		return nil, fmt.Errorf("error getting new members: %w", err)
+	}
+	defer rows.Close()
+
+	var discordIds []string
+	for rows.Next() {
+		var discordId string
+		if err := rows.Scan(&discordId); err != nil {
+			return nil, fmt.Errorf("error scanning new member: %w", err)
+		}
+		discordIds = append(discordIds, discordId)
+	}
+
+	return discordIds, rows.Err()
+}
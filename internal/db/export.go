@@ -0,0 +1,283 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// A Registration is an AOE4 account linked by a Discord user, along with the user's membership
+// on a guild and the stored ratings of the account.
+type Registration struct {
+	DiscordID string `json:"discord_id"`
+	// GuildID is empty if the user has not opted in to Elo tracking on any guild.
+	GuildID   string `json:"guild_id,omitempty"`
+	Visible   bool   `json:"visible"`
+	AoeID     string `json:"aoe_id"`
+	Username  string `json:"username"`
+	IsPrimary bool   `json:"is_primary"`
+	// Ratings holds the Elo value of each mode in Modes with a stored value.
+	Ratings map[string]int16 `json:"ratings,omitempty"`
+}
+
+// ExportRegistrations returns the registrations of all users that opted in to Elo tracking on the guild
+// specified by guildId, or of all users if guildId is empty. An account that opted in to several guilds
+// has a registration for each of them, and only the first one holds the ratings of the account.
+func ExportRegistrations(guildId string) ([]Registration, error) {
+	rows, err := Db.Query(context.Background(),
+		`select a.discord_id, coalesce(g.guild_id, ''), coalesce(g.visible, false), a.aoe_id, a.username, a.is_primary
+		 from accounts a
+		 left join guild_users g using (discord_id)
+		 where $1 = '' or g.guild_id = $1
+		 order by g.guild_id, a.discord_id, a.is_primary desc, a.aoe_id`,
+		guildId)
+	if err != nil {
+		return nil, fmt.Errorf("error getting registrations: %w", err)
+	}
+	defer rows.Close()
+
+	var regs []Registration
+	for rows.Next() {
+		var r Registration
+		if err := rows.Scan(&r.DiscordID, &r.GuildID, &r.Visible, &r.AoeID, &r.Username, &r.IsPrimary); err != nil {
+			return nil, fmt.Errorf("error scanning registration: %w", err)
+		}
+		regs = append(regs, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error getting registrations: %w", err)
+	}
+
+	if err := loadRegistrationRatings(regs); err != nil {
+		return nil, err
+	}
+
+	return regs, nil
+}
+
+func loadRegistrationRatings(regs []Registration) error {
+	if len(regs) == 0 {
+		return nil
+	}
+
+	aoeIds := make([]string, len(regs))
+	for i, r := range regs {
+		aoeIds[i] = r.AoeID
+	}
+
+	rows, err := Db.Query(context.Background(),
+		"select aoe_id, mode, elo from ratings where elo is not null and aoe_id = any($1)", aoeIds)
+	if err != nil {
+		return fmt.Errorf("error getting ratings: %w", err)
+	}
+	defer rows.Close()
+
+	ratings := make(map[string]map[string]int16)
+	for rows.Next() {
+		var aoeId, mode string
+		var elo int16
+		if err := rows.Scan(&aoeId, &mode, &elo); err != nil {
+			return fmt.Errorf("error scanning rating: %w", err)
+		}
+		if ratings[aoeId] == nil {
+			ratings[aoeId] = make(map[string]int16, len(Modes))
+		}
+		ratings[aoeId][mode] = elo
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error getting ratings: %w", err)
+	}
+
+	// Ratings are shared by all registrations of an account, so they are only written once.
+	for i := range regs {
+		regs[i].Ratings = ratings[regs[i].AoeID]
+		delete(ratings, regs[i].AoeID)
+	}
+
+	return nil
+}
+
+// ImportRegistrations stores regs in a single transaction. Registrations that conflict with an existing account,
+// guild membership or rating overwrite it if overwrite is true, and are skipped otherwise. An account and its
+// ratings are only stored from the first registration of the account, the others only add guild memberships.
+// Stored ratings are recorded in the rating history. Each user is left with exactly one primary account,
+// which is the existing one when skipping conflicts.
+// It returns the number of registrations that changed anything and the number that were skipped entirely.
+func ImportRegistrations(regs []Registration, overwrite bool) (imported int, skipped int, err error) {
+	for i, r := range regs {
+		if r.DiscordID == "" || r.AoeID == "" || r.Username == "" {
+			return 0, 0, fmt.Errorf("registration %d is missing discord_id, aoe_id or username", i+1)
+		}
+		for mode := range r.Ratings {
+			if !isMode(mode) {
+				return 0, 0, fmt.Errorf("registration %d has a rating for unknown mode %q", i+1, mode)
+			}
+		}
+	}
+
+	ctx := context.Background()
+	tx, err := Db.Begin(ctx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error starting import transaction: %w", err)
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	accountConflict := "do nothing"
+	guildConflict := "do nothing"
+	ratingConflict := "do nothing"
+	if overwrite {
+		accountConflict = "do update set username = excluded.username, is_primary = excluded.is_primary " +
+			"where (accounts.username, accounts.is_primary) is distinct from (excluded.username, excluded.is_primary)"
+		guildConflict = "do update set visible = excluded.visible where guild_users.visible <> excluded.visible"
+		ratingConflict = "do update set elo = excluded.elo, changed_at = excluded.changed_at " +
+			"where ratings.elo is distinct from excluded.elo"
+	}
+
+	type accountKey struct{ discordId, aoeId string }
+	seenAccounts := make(map[accountKey]bool, len(regs))
+	seenRatings := make(map[string]bool, len(regs))
+	discordIds := make([]string, 0, len(regs))
+	for _, r := range regs {
+		var affected int64
+
+		if key := (accountKey{r.DiscordID, r.AoeID}); !seenAccounts[key] {
+			seenAccounts[key] = true
+
+			if overwrite && r.IsPrimary {
+				if _, err := tx.Exec(ctx,
+					"update accounts set is_primary = false where discord_id = $1 and aoe_id <> $2",
+					r.DiscordID, r.AoeID); err != nil {
+					return 0, 0, fmt.Errorf("error updating primary account: %w", err)
+				}
+			}
+
+			tag, err := tx.Exec(ctx,
+				`insert into accounts(discord_id, aoe_id, username, is_primary)
+				 values($1, $2, $3, $4 and not exists (select from accounts where discord_id = $1 and is_primary))
+				 on conflict (discord_id, aoe_id) `+accountConflict,
+				r.DiscordID, r.AoeID, r.Username, r.IsPrimary)
+			if err != nil {
+				return 0, 0, fmt.Errorf("error importing account: %w", err)
+			}
+			affected += tag.RowsAffected()
+		}
+
+		if r.GuildID != "" {
+			tag, err := tx.Exec(ctx,
+				`insert into guild_users(discord_id, guild_id, visible) values($1, $2, $3)
+				 on conflict (discord_id, guild_id) `+guildConflict,
+				r.DiscordID, r.GuildID, r.Visible)
+			if err != nil {
+				return 0, 0, fmt.Errorf("error importing guild membership: %w", err)
+			}
+			affected += tag.RowsAffected()
+		}
+
+		// Ratings are shared by all registrations of an account, so only the first ones given are stored.
+		if len(r.Ratings) != 0 && !seenRatings[r.AoeID] {
+			seenRatings[r.AoeID] = true
+
+			for mode, elo := range r.Ratings {
+				tag, err := tx.Exec(ctx,
+					`insert into ratings(aoe_id, mode, elo, changed_at) values($1, $2, $3, now())
+					 on conflict (aoe_id, mode) `+ratingConflict,
+					r.AoeID, mode, elo)
+				if err != nil {
+					return 0, 0, fmt.Errorf("error importing rating: %w", err)
+				}
+				if tag.RowsAffected() == 0 {
+					continue
+				}
+				affected += tag.RowsAffected()
+
+				if _, err := tx.Exec(ctx,
+					`insert into rating_history(aoe_id, mode, elo) values($1, $2, $3) on conflict do nothing`,
+					r.AoeID, mode, elo); err != nil {
+					return 0, 0, fmt.Errorf("error recording imported rating: %w", err)
+				}
+			}
+		}
+
+		if affected == 0 {
+			skipped++
+		} else {
+			imported++
+		}
+		discordIds = append(discordIds, r.DiscordID)
+	}
+
+	if _, err := tx.Exec(ctx,
+		`update accounts a set is_primary = (aoe_id = (
+		 select aoe_id from accounts b where b.discord_id = a.discord_id order by is_primary desc, aoe_id limit 1))
+		 where discord_id = any($1)`,
+		discordIds); err != nil {
+		return 0, 0, fmt.Errorf("error updating primary accounts: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, 0, fmt.Errorf("error committing import: %w", err)
+	}
+
+	return imported, skipped, nil
+}
+
+// ImportGuildMemberships opts the users of regs in to the guild specified by guildId with the visibility of
+// their registration, leaving accounts and ratings untouched. Users who already opted in to the guild get
+// the visibility of their registration if overwrite is true, and are skipped otherwise. Registrations for
+// other guilds or for accounts that are not linked are skipped.
+// It returns the number of registrations that changed anything and the number that were skipped.
+func ImportGuildMemberships(guildId string, regs []Registration, overwrite bool) (imported int, skipped int, err error) {
+	for i, r := range regs {
+		if r.DiscordID == "" || r.AoeID == "" {
+			return 0, 0, fmt.Errorf("registration %d is missing discord_id or aoe_id", i+1)
+		}
+	}
+
+	ctx := context.Background()
+	tx, err := Db.Begin(ctx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error starting import transaction: %w", err)
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	conflict := "do nothing"
+	if overwrite {
+		conflict = "do update set visible = excluded.visible where guild_users.visible <> excluded.visible"
+	}
+
+	for _, r := range regs {
+		if r.GuildID != guildId {
+			skipped++
+			continue
+		}
+
+		tag, err := tx.Exec(ctx,
+			`insert into guild_users(discord_id, guild_id, visible)
+			 select $1, $2, $3 where exists (select from accounts where discord_id = $1 and aoe_id = $4)
+			 on conflict (discord_id, guild_id) `+conflict,
+			r.DiscordID, guildId, r.Visible, r.AoeID)
+		if err != nil {
+			return 0, 0, fmt.Errorf("error importing guild membership: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			skipped++
+		} else {
+			imported++
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, 0, fmt.Errorf("error committing import: %w", err)
+	}
+
+	return imported, skipped, nil
+}
+
+func isMode(mode string) bool {
+	for _, m := range Modes {
+		if m == mode {
+			return true
+		}
+	}
+
+	return false
+}
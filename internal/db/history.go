@@ -0,0 +1,73 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+)
+
+// RatingBaselines holds earlier values of a rating, each 0 if no value was recorded at that time.
+type RatingBaselines struct {
+	// Previous is the value before the most recent change.
+	Previous int16
+	// WeekStart is the value at the start of the current week.
+	WeekStart int16
+	// RoleChange is the value at the last Elo role change of the member.
+	RoleChange int16
+}
+
+// GetRatingBaselines returns the baselines of each rating of the AOE4 account specified by aoeId, in the same
+// order as Modes. weekStart is the start of the current week, and roleChanges holds the time of the last
+// Elo role change of the member for each mode, or the zero time if there was none.
+func GetRatingBaselines(aoeId string, weekStart time.Time, roleChanges [len(Modes)]time.Time) ([len(Modes)]RatingBaselines, error) {
+	var baselines [len(Modes)]RatingBaselines
+
+	batch := &pgx.Batch{}
+	for i, mode := range Modes {
+		batch.Queue(
+			`select elo from rating_history where aoe_id = $1 and mode = $2
+			 order by recorded_at desc offset 1 limit 1`,
+			aoeId, mode)
+		batch.Queue(
+			`select elo from rating_history where aoe_id = $1 and mode = $2 and recorded_at < $3
+			 order by recorded_at desc limit 1`,
+			aoeId, mode, weekStart)
+		if !roleChanges[i].IsZero() {
+			batch.Queue(
+				`select elo from rating_history where aoe_id = $1 and mode = $2 and recorded_at <= $3
+				 order by recorded_at desc limit 1`,
+				aoeId, mode, roleChanges[i])
+		}
+	}
+
+	br := Db.SendBatch(context.Background(), batch)
+	defer br.Close()
+
+	scan := func(elo *int16) error {
+		var v pgtype.Int2
+		if err := br.QueryRow().Scan(&v); err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("error getting rating history: %w", err)
+		}
+		*elo = v.Int
+		return nil
+	}
+	for i := range Modes {
+		if err := scan(&baselines[i].Previous); err != nil {
+			return baselines, err
+		}
+		if err := scan(&baselines[i].WeekStart); err != nil {
+			return baselines, err
+		}
+		if !roleChanges[i].IsZero() {
+			if err := scan(&baselines[i].RoleChange); err != nil {
+				return baselines, err
+			}
+		}
+	}
+
+	return baselines, nil
+}
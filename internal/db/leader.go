@@ -0,0 +1,81 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// leaderLockClass is the first key of the advisory locks held by the leader of each shard.
+// The second key is the shard ID.
+const leaderLockClass int32 = 0x616f6534
+
+// A LeaderElector holds the advisory locks that make the instance the leader of its shards.
+// The locks are held on a connection separate from the pool, so that they are released
+// by Postgres as soon as the instance dies or loses its connection.
+type LeaderElector struct {
+	conn *pgx.Conn
+	held map[int]bool
+}
+
+// NewLeaderElector returns a LeaderElector that holds no locks.
+func NewLeaderElector() *LeaderElector {
+	return &LeaderElector{held: make(map[int]bool)}
+}
+
+// Elect tries to become the leader of each of shardIds that another instance does not lead,
+// and returns the shards the instance leads. If the connection holding the locks was lost,
+// leadership of all shards is given up before trying again on a new connection.
+func (e *LeaderElector) Elect(ctx context.Context, shardIds []int) (map[int]bool, error) {
+	if e.conn != nil {
+		if err := e.conn.Ping(ctx); err != nil {
+			e.conn.Close(ctx) //nolint:errcheck
+			e.conn = nil
+		}
+	}
+	if e.conn == nil {
+		e.held = make(map[int]bool)
+		conn, err := pgx.ConnectConfig(ctx, Db.Config().ConnConfig.Copy())
+		if err != nil {
+			return e.leading(), fmt.Errorf("error connecting to db for leader election: %w", err)
+		}
+		e.conn = conn
+	}
+
+	for _, shardId := range shardIds {
+		if e.held[shardId] {
+			continue
+		}
+
+		var acquired bool
+		if err := e.conn.QueryRow(ctx, `select pg_try_advisory_lock($1, $2)`, leaderLockClass, int32(shardId)).
+			Scan(&acquired); err != nil {
+			return e.leading(), fmt.Errorf("error acquiring leader lock for shard %d: %w", shardId, err)
+		}
+		e.held[shardId] = acquired
+	}
+
+	return e.leading(), nil
+}
+
+func (e *LeaderElector) leading() map[int]bool {
+	leading := make(map[int]bool, len(e.held))
+	for shardId, held := range e.held {
+		if held {
+			leading[shardId] = true
+		}
+	}
+
+	return leading
+}
+
+// Close gives up leadership of all shards.
+func (e *LeaderElector) Close(ctx context.Context) error {
+	if e.conn == nil {
+		return nil
+	}
+	e.held = make(map[int]bool)
+
+	return e.conn.Close(ctx)
+}
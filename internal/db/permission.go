@@ -0,0 +1,90 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// Types of CommandRule.
+const (
+	// RuleRole allows members with the role whose ID is the rule value.
+	RuleRole = "role"
+	// RulePermission allows members with the Discord permission whose bit is the rule value.
+	RulePermission = "permission"
+	// RuleUser allows the user whose ID is the rule value.
+	RuleUser = "user"
+	// RuleDisabled disables the command for everyone.
+	RuleDisabled = "disabled"
+)
+
+// A CommandRule restricts who can use a command on a guild.
+type CommandRule struct {
+	Rule  string
+	Value string
+}
+
+// GetCommandRules returns the permission rules of each command with rules on the guild specified by guildId.
+func GetCommandRules(guildId string) (map[string][]CommandRule, error) {
+	rows, err := Db.Query(context.Background(),
+		"select command, rule, value from command_permissions where guild_id = $1 order by command, rule, value",
+		guildId)
+	if err != nil {
+		return nil, fmt.Errorf("error getting command permissions: %w", err)
+	}
+	defer rows.Close()
+
+	rules := make(map[string][]CommandRule)
+	for rows.Next() {
+		var command string
+		var rule CommandRule
+		if err := rows.Scan(&command, &rule.Rule, &rule.Value); err != nil {
+			return nil, fmt.Errorf("error scanning command permission: %w", err)
+		}
+		rules[command] = append(rules[command], rule)
+	}
+
+	return rules, rows.Err()
+}
+
+// AddCommandRule adds rule to the command specified by command on the guild specified by guildId.
+// Adding RuleDisabled removes all other rules, and adding any other rule removes RuleDisabled.
+func AddCommandRule(guildId string, command string, rule CommandRule) error {
+	ctx := context.Background()
+	tx, err := Db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	deleteSql := "delete from command_permissions where guild_id = $1 and command = $2 and rule = 'disabled'"
+	if rule.Rule == RuleDisabled {
+		deleteSql = "delete from command_permissions where guild_id = $1 and command = $2"
+	}
+	if _, err := tx.Exec(ctx, deleteSql, guildId, command); err != nil {
+		return fmt.Errorf("error updating command permissions: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx,
+		`insert into command_permissions(guild_id, command, rule, value) values($1, $2, $3, $4)
+		 on conflict do nothing`,
+		guildId, command, rule.Rule, rule.Value); err != nil {
+		return fmt.Errorf("error adding command permission: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("error committing command permissions: %w", err)
+	}
+
+	return nil
+}
+
+// ResetCommandRules removes all rules of the command specified by command on the guild specified by guildId,
+// restoring its default permissions.
+func ResetCommandRules(guildId string, command string) error {
+	if _, err := Db.Exec(context.Background(),
+		"delete from command_permissions where guild_id = $1 and command = $2", guildId, command); err != nil {
+		return fmt.Errorf("error resetting command permissions: %w", err)
+	}
+
+	return nil
+}
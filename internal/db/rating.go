@@ -0,0 +1,246 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/config"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+)
+
+// RatingStatus holds the result of the most recent attempts to retrieve a rating.
+type RatingStatus struct {
+	// ChangedAt is the last time the rating was retrieved with a different value.
+	ChangedAt time.Time
+	// FetchedAt is the time of the last successful retrieval, or the zero time if the rating was never found.
+	FetchedAt time.Time
+	// LastError is the error of the last failed retrieval, or an empty string if the last retrieval succeeded.
+	LastError string
+	// Failures is the number of consecutive failed retrievals.
+	Failures int
+}
+
+// PlayerStats holds the leaderboard statistics of a player for a single Elo type.
+type PlayerStats struct {
+	Rating int16
+	// Rank is the position of the player on the leaderboard, or 0 if it is unknown.
+	Rank   int
+	Wins   int
+	Losses int
+	// WinRate is the percentage of games won.
+	WinRate float64
+	// WinStreak is the number of consecutive games won, or lost if negative.
+	WinStreak int
+	// LastPlayed is the last time the number of games played was seen to change,
+	// or the zero time if it never was.
+	LastPlayed time.Time
+}
+
+// Games returns the number of games played.
+func (ps PlayerStats) Games() int {
+	return ps.Wins + ps.Losses
+}
+
+// Modes holds the names under which ratings are stored, in the same order as the Elo types of the config.
+var Modes = [...]string{"1v1", "2v2", "3v3", "4v4", "custom"}
+
+// Stale reports whether the rating was not retrieved successfully within staleAfter.
+func (rs RatingStatus) Stale(staleAfter time.Duration) bool {
+	return time.Since(rs.FetchedAt) > staleAfter
+}
+
+// UpdateUserElo stores the new Elo values and their retrieval status for the Elo types of u enabled in cfg,
+// and records the values that differ from the current ones in the rating history. cfg must be the config
+// the new Elo values were retrieved with. Ratings are shared by all users that linked the same AOE4 account.
+func UpdateUserElo(cfg *config.ConfigFile, u *User) error {
+	newElo := u.NewElo.Values()
+	currentElo := u.CurrentElo.Values()
+	eloTypes := cfg.EloTypes
+
+	batch := &pgx.Batch{}
+	for i, mode := range Modes {
+		if !eloTypes[i].Enabled {
+			continue
+		}
+
+		batch.Queue(
+			`insert into ratings(aoe_id, mode, elo, fetched_at, last_error, error_at, failures, changed_at, league,
+			 rank, wins, losses, win_rate, win_streak, last_played)
+			 values($1, $2, $3, $4, $5, case when $5::text is null then null else now() end, $6, $7, $8,
+			 $9, $10, $11, $12, $13, $14)
+			 on conflict (aoe_id, mode) do update set
+			 elo = excluded.elo,
+			 league = excluded.league,
+			 rank = excluded.rank,
+			 wins = excluded.wins,
+			 losses = excluded.losses,
+			 win_rate = excluded.win_rate,
+			 win_streak = excluded.win_streak,
+			 last_played = excluded.last_played,
+			 fetched_at = excluded.fetched_at,
+			 changed_at = excluded.changed_at,
+			 last_error = excluded.last_error,
+			 error_at = coalesce(excluded.error_at, ratings.error_at),
+			 failures = excluded.failures`,
+			u.Aoe4Id,
+			mode,
+			nullInt2(newElo[i]),
+			nullTime(u.Status[i].FetchedAt),
+			nullText(u.Status[i].LastError),
+			u.Status[i].Failures,
+			nullTime(u.Status[i].ChangedAt),
+			nullText(u.League[i]),
+			nullInt(u.Stats[i].Rank),
+			u.Stats[i].Wins,
+			u.Stats[i].Losses,
+			u.Stats[i].WinRate,
+			u.Stats[i].WinStreak,
+			nullTime(u.Stats[i].LastPlayed))
+
+		if newElo[i] != 0 && newElo[i] != currentElo[i] {
+			batch.Queue(
+				`insert into rating_history(aoe_id, mode, elo) values($1, $2, $3) on conflict do nothing`,
+				u.Aoe4Id, mode, newElo[i])
+		}
+	}
+
+	br := Db.SendBatch(context.Background(), batch)
+	defer br.Close()
+
+	for i := 0; i < batch.Len(); i++ {
+		if _, err := br.Exec(); err != nil {
+			return fmt.Errorf("error updating rating in db: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// loadRatings sets the current Elo values and retrieval status of all Elo types for users. Disabled Elo types
+// are loaded as well, so that the config in effect is only applied by callers, with the snapshot they use.
+func loadRatings(users []User) error {
+	if len(users) == 0 {
+		return nil
+	}
+
+	aoeIds := make([]string, len(users))
+	for i, u := range users {
+		aoeIds[i] = u.Aoe4Id
+	}
+
+	rows, err := Db.Query(context.Background(),
+		`select aoe_id, mode, elo, league, fetched_at, changed_at, last_error, failures,
+		 rank, wins, losses, win_rate, win_streak, last_played
+		 from ratings where aoe_id = any($1)`,
+		aoeIds)
+	if err != nil {
+		return fmt.Errorf("error getting ratings: %w", err)
+	}
+	defer rows.Close()
+
+	type rating struct {
+		elo    pgtype.Int2
+		league pgtype.Text
+		status RatingStatus
+		stats  PlayerStats
+	}
+	ratings := make(map[string]map[string]rating)
+	for rows.Next() {
+		var aoeId, mode string
+		var r rating
+		var fetchedAt, changedAt pgtype.Timestamptz
+		var lastError pgtype.Text
+		var rank, wins, losses, winStreak pgtype.Int4
+		var winRate pgtype.Float4
+		var lastPlayed pgtype.Timestamptz
+		if err := rows.Scan(&aoeId, &mode, &r.elo, &r.league, &fetchedAt, &changedAt, &lastError, &r.status.Failures,
+			&rank, &wins, &losses, &winRate, &winStreak, &lastPlayed); err != nil {
+			return fmt.Errorf("error scanning rating: %w", err)
+		}
+		r.stats = PlayerStats{
+			Rating:    r.elo.Int,
+			Rank:      int(rank.Int),
+			Wins:      int(wins.Int),
+			Losses:    int(losses.Int),
+			WinRate:   float64(winRate.Float),
+			WinStreak: int(winStreak.Int),
+		}
+		if lastPlayed.Status == pgtype.Present {
+			r.stats.LastPlayed = lastPlayed.Time
+		}
+		if fetchedAt.Status == pgtype.Present {
+			r.status.FetchedAt = fetchedAt.Time
+		}
+		if changedAt.Status == pgtype.Present {
+			r.status.ChangedAt = changedAt.Time
+		}
+		r.status.LastError = lastError.String
+
+		if ratings[aoeId] == nil {
+			ratings[aoeId] = make(map[string]rating, len(Modes))
+		}
+		ratings[aoeId][mode] = r
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error getting ratings: %w", err)
+	}
+
+	for i := range users {
+		currentElo := users[i].CurrentElo.pointers()
+		for j, mode := range Modes {
+			r, ok := ratings[users[i].Aoe4Id][mode]
+			if !ok {
+				continue
+			}
+
+			if r.elo.Status == pgtype.Present {
+				*currentElo[j] = r.elo.Int
+			}
+			users[i].Status[j] = r.status
+			users[i].League[j] = r.league.String
+			users[i].Stats[j] = r.stats
+		}
+	}
+
+	return nil
+}
+
+// Values returns the Elo values in the same order as Modes.
+func (e *userElo) Values() [len(Modes)]int16 {
+	return [...]int16{e.OneVOne, e.TwoVTwo, e.ThreeVThree, e.FourVFour, e.Custom}
+}
+
+// pointers returns pointers to the Elo values in the same order as Modes.
+func (e *userElo) pointers() [len(Modes)]*int16 {
+	return [...]*int16{&e.OneVOne, &e.TwoVTwo, &e.ThreeVThree, &e.FourVFour, &e.Custom}
+}
+
+func nullInt2(i int16) interface{} {
+	if i == 0 {
+		return nil
+	}
+	return i
+}
+
+func nullInt(i int) interface{} {
+	if i == 0 {
+		return nil
+	}
+	return i
+}
+
+func nullText(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
@@ -0,0 +1,107 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// roleSyncLockClass is the first key of the advisory locks held while the Elo roles of a guild are synced.
+// The second key is a hash of the guild ID.
+const roleSyncLockClass int32 = 0x726f6c65
+
+// A GuildRoleKey identifies a role created by the bot for an Elo type ladder.
+type GuildRoleKey struct {
+	Mode string
+	Name string
+}
+
+// A querier runs queries on the pool or on a single connection.
+type querier interface {
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
+}
+
+// GetGuildRoles returns the IDs of the roles created by the bot on the guild specified by guildId.
+func GetGuildRoles(guildId string) (map[GuildRoleKey]string, error) {
+	return getGuildRoles(Db, guildId)
+}
+
+func getGuildRoles(q querier, guildId string) (map[GuildRoleKey]string, error) {
+	rows, err := q.Query(context.Background(),
+		"select mode, name, role_id from guild_roles where guild_id = $1", guildId)
+	if err != nil {
+		return nil, fmt.Errorf("error getting guild roles: %w", err)
+	}
+	defer rows.Close()
+
+	roles := make(map[GuildRoleKey]string)
+	for rows.Next() {
+		var key GuildRoleKey
+		var roleId string
+		if err := rows.Scan(&key.Mode, &key.Name, &roleId); err != nil {
+			return nil, fmt.Errorf("error scanning guild role: %w", err)
+		}
+		roles[key] = roleId
+	}
+
+	return roles, rows.Err()
+}
+
+func setGuildRole(q querier, guildId string, key GuildRoleKey, roleId string) error {
+	if _, err := q.Exec(context.Background(),
+		`insert into guild_roles(guild_id, mode, name, role_id) values($1, $2, $3, $4)
+		 on conflict (guild_id, mode, name) do update set role_id = excluded.role_id`,
+		guildId, key.Mode, key.Name, roleId); err != nil {
+		return fmt.Errorf("error setting guild role in db: %w", err)
+	}
+
+	return nil
+}
+
+// A GuildRoleLock is held while the Elo roles of a guild are synced. The roles are read and stored
+// through it, on the connection holding the lock, so that a sync never waits for a second connection.
+type GuildRoleLock struct {
+	conn    *pgxpool.Conn
+	guildId string
+}
+
+// LockGuildRoles waits until no other sync of the Elo roles of the guild specified by guildId holds its lock,
+// on this or any other instance, and takes it. The lock must be released with Unlock.
+func LockGuildRoles(ctx context.Context, guildId string) (*GuildRoleLock, error) {
+	conn, err := Db.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error acquiring connection for guild role lock: %w", err)
+	}
+	if _, err := conn.Exec(ctx, "select pg_advisory_lock($1, hashtext($2))", roleSyncLockClass, guildId); err != nil {
+		conn.Release()
+		return nil, fmt.Errorf("error locking guild roles: %w", err)
+	}
+
+	return &GuildRoleLock{conn: conn, guildId: guildId}, nil
+}
+
+// Roles returns the IDs of the roles created by the bot on the locked guild.
+func (l *GuildRoleLock) Roles() (map[GuildRoleKey]string, error) {
+	return getGuildRoles(l.conn, l.guildId)
+}
+
+// SetRole stores the ID of a role created by the bot on the locked guild.
+func (l *GuildRoleLock) SetRole(key GuildRoleKey, roleId string) error {
+	return setGuildRole(l.conn, l.guildId, key, roleId)
+}
+
+// Unlock releases the lock and its connection.
+func (l *GuildRoleLock) Unlock() {
+	if _, err := l.conn.Exec(context.Background(),
+		"select pg_advisory_unlock($1, hashtext($2))", roleSyncLockClass, l.guildId); err != nil {
+		log.Printf("error unlocking guild roles of guild %s: %v\n", l.guildId, err)
+		// Closing the connection releases the lock, and keeps it from returning to the pool.
+		l.conn.Conn().Close(context.Background()) //nolint:errcheck
+	}
+	l.conn.Release()
+}
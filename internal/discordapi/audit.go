@@ -0,0 +1,111 @@
+package discordapi
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/config"
+	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/db"
+	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/locale"
+	"github.com/bwmarrin/discordgo"
+)
+
+// auditLimit is the number of entries shown by the audit command.
+const auditLimit = 25
+
+// recordAudit stores e in the audit log and mirrors it to the mod log channel of cfg, if one is configured
+// on the guild of e. Errors are only logged, so that auditing never prevents a change.
+func recordAudit(cfg *config.ConfigFile, s *discordgo.Session, e db.AuditEntry) {
+	e.CreatedAt = time.Now()
+	if err := db.AddAuditEntry(e); err != nil {
+		log.Println(err)
+	}
+
+	channelId := cfg.ModLogChannelId
+	if channelId == "" {
+		return
+	}
+	if channel, err := s.State.Channel(channelId); err != nil || channel.GuildID != e.GuildID {
+		return
+	}
+
+	s.ChannelMessageSendComplex(channelId, &discordgo.MessageSend{ //nolint:errcheck
+		Content:         auditString(guildLocale(e.GuildID), e, "2006-01-02 15:04"),
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+}
+
+// auditString formats e in the locale specified by lang, with its time formatted with timeLayout.
+func auditString(lang string, e db.AuditEntry, timeLayout string) string {
+	actor := locale.Get(lang, locale.AuditBot)
+	if e.ActorID != "" {
+		actor = "<@" + e.ActorID + ">"
+	}
+
+	value := func(v string) string {
+		switch {
+		case v == "":
+			return "-"
+		case e.Action == db.AuditRoleChange:
+			return "<@&" + v + ">"
+		default:
+			return v
+		}
+	}
+
+	return locale.Get(lang, locale.AuditEntry,
+		e.CreatedAt.UTC().Format(timeLayout),
+		actor,
+		e.Action,
+		"<@"+e.TargetID+">",
+		value(e.OldValue),
+		value(e.NewValue))
+}
+
+// audit records a change made by the author of the command to the user specified by targetId.
+func (c *command) audit(targetId string, action string, oldValue string, newValue string) {
+	recordAudit(config.Get(), c.s, db.AuditEntry{
+		GuildID:  c.m.GuildID,
+		ActorID:  c.m.Author.ID,
+		TargetID: targetId,
+		Action:   action,
+		OldValue: oldValue,
+		NewValue: newValue,
+	})
+}
+
+func (c *command) showAudit() {
+	var targetId string
+	if args := c.args(); args != "" {
+		if !strings.HasPrefix(args, "<@") {
+			c.replyUsage(locale.UserNotRegistered)
+			return
+		}
+		targetId = strings.Trim(args, "<@!>")
+	}
+
+	entries, err := db.GetAuditEntries(c.m.GuildID, targetId, auditLimit)
+	if err != nil {
+		c.replyUsage(locale.EloInfoFailed)
+		log.Printf("error getting audit entries: %v\n", err)
+		return
+	}
+	if len(entries) == 0 {
+		c.reply(c.t(locale.AuditNone))
+		return
+	}
+
+	var builder strings.Builder
+	builder.WriteString(c.t(locale.AuditHeader))
+	for _, e := range entries {
+		builder.WriteString(auditString(c.lang, e, "2006-01-02 15:04"))
+	}
+
+	c.replyLong(builder.String())
+}
+
+// accountValue formats an AOE4 account for the audit log.
+func accountValue(username string, aoeId string) string {
+	return username + " (" + aoeId + ")"
+}
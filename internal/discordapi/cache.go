@@ -0,0 +1,117 @@
+package discordapi
+
+import (
+	"sync"
+	"time"
+
+	"github.com/alexisgeoffrey/aoe4api"
+	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/db"
+)
+
+// A ratingKey identifies the rating of a player for the Elo type at an index of the EloTypes of the config.
+type ratingKey struct {
+	aoeId string
+	mode  int
+}
+
+// negativeRatingTTL is the longest time a failed query is cached, such as for a mode the player has not played.
+const negativeRatingTTL = time.Minute
+
+type cachedRating struct {
+	stats     db.PlayerStats
+	league    string
+	err       error
+	fetchedAt time.Time
+}
+
+// expired reports whether r is older than ttl, or than negativeRatingTTL if it is a failed query.
+func (r cachedRating) expired(ttl time.Duration) bool {
+	if r.err != nil && negativeRatingTTL < ttl {
+		ttl = negativeRatingTTL
+	}
+
+	return time.Since(r.fetchedAt) >= ttl
+}
+
+// ratingCache holds the ratings recently retrieved from the leaderboard,
+// so that repeated requests for the same player do not query it again.
+var ratingCache = struct {
+	ratings map[ratingKey]cachedRating
+	// sweptAt is the last time expired ratings were dropped, so that the cache does not grow
+	// with every player ever seen.
+	sweptAt time.Time
+	sync.Mutex
+}{ratings: make(map[ratingKey]cachedRating)}
+
+// ratingFlights de-duplicates concurrent leaderboard queries for the same rating.
+var ratingFlights = flightGroup{calls: make(map[ratingKey]*flightCall)}
+
+// cachedQueryElo returns the statistics of the player specified by key, querying the leaderboard with req
+// unless they were retrieved within ttl. Failed queries are cached as well, for at most negativeRatingTTL.
+// If force is true, the leaderboard is always queried. Concurrent calls for the same rating share a single query.
+func cachedQueryElo(req aoe4api.Request, key ratingKey, ttl time.Duration, force bool) (stats db.PlayerStats, league string, err error) {
+	if !force {
+		ratingCache.Lock()
+		r, ok := ratingCache.ratings[key]
+		ratingCache.Unlock()
+		if ok && !r.expired(ttl) {
+			return r.stats, r.league, r.err
+		}
+	}
+
+	r, _ := ratingFlights.do(key, func() (cachedRating, error) {
+		stats, league, err := queryElo(req, key.aoeId)
+		return cachedRating{stats: stats, league: league, err: err, fetchedAt: time.Now()}, err
+	})
+
+	ratingCache.Lock()
+	ratingCache.ratings[key] = r
+	if time.Since(ratingCache.sweptAt) >= ttl {
+		for k, cached := range ratingCache.ratings {
+			if cached.expired(ttl) {
+				delete(ratingCache.ratings, k)
+			}
+		}
+		ratingCache.sweptAt = time.Now()
+	}
+	ratingCache.Unlock()
+
+	return r.stats, r.league, r.err
+}
+
+// A flightCall is a leaderboard query in progress, whose result is shared by all callers waiting on it.
+type flightCall struct {
+	wg     sync.WaitGroup
+	rating cachedRating
+	err    error
+}
+
+// A flightGroup runs a single query at a time for each rating.
+type flightGroup struct {
+	calls map[ratingKey]*flightCall
+	sync.Mutex
+}
+
+// do runs fn for key and returns its result, or waits for and returns the result of the call for key
+// already in progress.
+func (g *flightGroup) do(key ratingKey, fn func() (cachedRating, error)) (cachedRating, error) {
+	g.Lock()
+	if call, ok := g.calls[key]; ok {
+		g.Unlock()
+		call.wg.Wait()
+		return call.rating, call.err
+	}
+	call := &flightCall{}
+	call.wg.Add(1)
+	g.calls[key] = call
+	g.Unlock()
+
+	call.rating, call.err = fn()
+	call.wg.Done()
+
+	g.Lock()
+	delete(g.calls, key)
+	g.Unlock()
+
+	return call.rating, call.err
+}
@@ -0,0 +1,181 @@
+package discordapi
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/config"
+	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/db"
+	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/locale"
+	"github.com/bwmarrin/discordgo"
+)
+
+// digestPeriod is the period summarized by the digest.
+const digestPeriod = 7 * 24 * time.Hour
+
+// PostDigests posts the weekly digest to each server in guilds, which maps the ID of each server
+// to the session it is connected through.
+func PostDigests(guilds map[string]*discordgo.Session) error {
+	guildIds := make([]string, 0, len(guilds))
+	for guildId := range guilds {
+		guildIds = append(guildIds, guildId)
+	}
+	sort.Strings(guildIds)
+
+	var errs []string
+	for _, guildId := range guildIds {
+		if err := PostDigest(guilds[guildId], guildId); err != nil {
+			errs = append(errs, fmt.Sprintf("error posting digest on guild %s: %v", guildId, err))
+		}
+	}
+	if len(errs) != 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// PostDigest posts a summary of the past week to the digest channel of the guild specified by guildId:
+// the largest Elo gains and losses and the highest Elo for each enabled Elo type, the Elo roles given
+// and the newly linked members. Nothing is posted if the guild has no digest channel or nothing to report.
+func PostDigest(s *discordgo.Session, guildId string) error {
+	settings, err := getGuildSettings(guildId)
+	if err != nil {
+		return err
+	}
+	channelId := digestChannel(s, guildId, settings)
+	if channelId == "" {
+		return nil
+	}
+
+	cfg := config.Get()
+	digest, err := db.GetDigest(cfg, guildId, time.Now().Add(-digestPeriod), cfg.DigestSize)
+	if err != nil {
+		return err
+	}
+
+	if msg := digestString(cfg, settings.Locale, digest); msg != "" {
+		sendLong(s, channelId, locale.Get(settings.Locale, locale.DigestHeader)+msg, nil)
+	}
+
+	return nil
+}
+
+// digestChannel returns the ID of the channel the digest of the guild specified by guildId is posted to,
+// or an empty string if it is not posted. By default, it is the bot channel if that channel is on the guild.
+func digestChannel(s *discordgo.Session, guildId string, settings *db.GuildSettings) string {
+	switch settings.DigestChannelId {
+	case db.DigestOff:
+		return ""
+	case "":
+		channelId := config.Get().BotChannelId
+		if channel, err := s.State.Channel(channelId); err != nil || channel.GuildID != guildId {
+			return ""
+		}
+		return channelId
+	default:
+		return settings.DigestChannelId
+	}
+}
+
+// digestString formats digest in the locale specified by lang, or returns an empty string if it is empty.
+func digestString(cfg *config.ConfigFile, lang string, digest *db.Digest) string {
+	var builder strings.Builder
+
+	changes := func(header string, ratings []db.DigestRating) {
+		if len(ratings) == 0 {
+			return
+		}
+		builder.WriteString(header)
+		for i, r := range ratings {
+			builder.WriteString(locale.Get(lang, locale.DigestRating, i+1, "<@"+r.DiscordID+">", r.Username, r.Elo, r.Change))
+		}
+	}
+
+	for i, mode := range db.Modes {
+		if !cfg.EloTypes[i].Enabled || len(digest.Top[mode]) == 0 {
+			continue
+		}
+
+		builder.WriteString(fmt.Sprintf("\n__%s__\n", modeLabels(lang)[i]))
+		changes(locale.Get(lang, locale.DigestGainers), digest.Gainers[mode])
+		changes(locale.Get(lang, locale.DigestLosers), digest.Losers[mode])
+		builder.WriteString(locale.Get(lang, locale.DigestTop, len(digest.Top[mode])))
+		for j, r := range digest.Top[mode] {
+			builder.WriteString(locale.Get(lang, locale.DigestTopRating, j+1, "<@"+r.DiscordID+">", r.Username, r.Elo))
+		}
+	}
+
+	if len(digest.NewRoles) != 0 {
+		builder.WriteString("\n" + locale.Get(lang, locale.DigestNewRoles))
+		for _, e := range digest.NewRoles {
+			builder.WriteString(locale.Get(lang, locale.DigestNewRole, "<@"+e.TargetID+">", "<@&"+e.NewValue+">"))
+		}
+	}
+
+	if len(digest.NewMembers) != 0 {
+		mentions := make([]string, len(digest.NewMembers))
+		for i, discordId := range digest.NewMembers {
+			mentions[i] = "<@" + discordId + ">"
+		}
+		builder.WriteString("\n" + locale.Get(lang, locale.DigestNewMembers, strings.Join(mentions, ", ")))
+	}
+
+	return builder.String()
+}
+
+func (c *command) setDigestChannel() {
+	args := strings.ToLower(c.args())
+	switch {
+	case args == "":
+		c.replyDigestChannel()
+		return
+
+	case args == db.DigestOff:
+		if err := db.SetGuildDigestChannel(c.m.GuildID, db.DigestOff); err != nil {
+			c.reply(c.t(locale.DigestChannelFailed))
+			log.Printf("error setting digest channel: %v\n", err)
+			return
+		}
+		invalidateGuildSettings(c.m.GuildID)
+		c.reply(c.t(locale.DigestChannelOff))
+		return
+	}
+
+	var channelId string
+	if args != "reset" {
+		channelId = strings.TrimSuffix(strings.TrimPrefix(args, "<#"), ">")
+		if channel, err := c.s.State.Channel(channelId); err != nil || channel.GuildID != c.m.GuildID {
+			c.replyUsage(locale.DigestChannelInvalid)
+			return
+		}
+	}
+
+	if err := db.SetGuildDigestChannel(c.m.GuildID, channelId); err != nil {
+		c.reply(c.t(locale.DigestChannelFailed))
+		log.Printf("error setting digest channel: %v\n", err)
+		return
+	}
+	invalidateGuildSettings(c.m.GuildID)
+
+	c.replyDigestChannel()
+}
+
+func (c *command) replyDigestChannel() {
+	settings, err := getGuildSettings(c.m.GuildID)
+	if err != nil {
+		c.reply(c.t(locale.DigestChannelFailed))
+		log.Println(err)
+		return
+	}
+
+	if channelId := digestChannel(c.s, c.m.GuildID, settings); channelId != "" {
+		c.reply(c.t(locale.DigestChannelCurrent, "<#"+channelId+">"))
+	} else {
+		c.reply(c.t(locale.DigestChannelNone))
+	}
+}
@@ -1,244 +1,761 @@
 package discordapi
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/config"
 	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/db"
+	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/locale"
 	"github.com/bwmarrin/discordgo"
 )
 
-const usageString = "Usage:\n```\n!setEloInfo SteamUsername/XboxLiveUsername, STEAMID64/XboxLiveID\nAliases: !set, !link\n\n!updateElo\nAliases: !update, !u\n\n!eloInfo [@User]\nAliases: !info, !stats, !i, !s\n```\nFind STEAMID64 @ https://steamid.io/lookup"
+// A command holds the state of a single command invocation.
+type command struct {
+	s              *discordgo.Session
+	m              *discordgo.MessageCreate
+	dedupedMessage string
+	prefix         string
+	lang           string
+}
 
 var cmdMutex sync.Mutex
 
+// guildCacheTTL is how long per-guild settings are cached. Changes made through another instance
+// are picked up once it expires.
+const guildCacheTTL = time.Minute
+
+var guildSettingsCache = struct {
+	settings  map[string]*db.GuildSettings
+	fetchedAt map[string]time.Time
+	// cfg is the config the settings fall back to, after which the cache is cleared when it is reloaded.
+	cfg *config.ConfigFile
+	sync.RWMutex
+}{settings: make(map[string]*db.GuildSettings), fetchedAt: make(map[string]time.Time)}
+
 // MessageCreate is the handler for Discordgo MessageCreate events.
 func MessageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
 	// Ignore all messages created by the bot itself
 	if m.Author.ID == s.State.User.ID {
 		return
 	}
-	dedupedMessage := strings.Join(strings.Fields(m.Content), " ")
-	switch lowerTrimmedMessage := strings.TrimSpace(strings.ToLower(dedupedMessage)); {
-	case // !setEloInfo
-		strings.HasPrefix(lowerTrimmedMessage, "!seteloinfo "),
-		strings.HasPrefix(lowerTrimmedMessage, "!set "),
-		strings.HasPrefix(lowerTrimmedMessage, "!link "):
 
+	settings, err := getGuildSettings(m.GuildID)
+	if err != nil {
+		log.Printf("error getting settings for guild %s: %v\n", m.GuildID, err)
+		return
+	}
+
+	content, ok := trimCommandPrefix(s, m.Content, settings)
+	if !ok {
+		return
+	}
+
+	c := &command{
+		s:              s,
+		m:              m,
+		dedupedMessage: strings.Join(strings.Fields(content), " "),
+		prefix:         settings.Prefix,
+		lang:           settings.Locale,
+	}
+
+	cmd, _, _ := strings.Cut(strings.ToLower(c.dedupedMessage), " ")
+	cmd = commandName(cmd)
+	if !isCommand(cmd) {
+		return
+	}
+
+	if userLocale, err := db.GetUserLocale(m.Author.ID); err != nil {
+		log.Printf("error getting locale for user %s: %v\n", m.Author.ID, err)
+	} else if userLocale != "" {
+		c.lang = userLocale
+	}
+
+	if !c.allowed(cmd) {
+		return
+	}
+
+	switch cmd {
+	case "seteloinfo":
 		cmdMutex.Lock()
 		defer cmdMutex.Unlock()
 
-		setEloInfo(s, m, dedupedMessage)
+		c.setEloInfo()
+
+	case "unlink":
+		cmdMutex.Lock()
+		defer cmdMutex.Unlock()
+
+		c.unlinkAccount()
+
+	case "primary":
+		cmdMutex.Lock()
+		defer cmdMutex.Unlock()
 
-	case // !updateElo
-		lowerTrimmedMessage == "!updateelo",
-		lowerTrimmedMessage == "!update",
-		lowerTrimmedMessage == "!u":
+		c.setPrimaryAccount()
 
+	case "optin":
 		cmdMutex.Lock()
 		defer cmdMutex.Unlock()
 
-		s.ChannelMessageSend(m.ChannelID, "Updating elo...") //nolint:errcheck
+		c.optIn()
+
+	case "optout":
+		cmdMutex.Lock()
+		defer cmdMutex.Unlock()
+
+		c.optOut()
+
+	case "visibility":
+		c.setVisibility()
+
+	case "updateelo":
+		cmdMutex.Lock()
+		defer cmdMutex.Unlock()
+
+		if strings.EqualFold(c.args(), "--dry-run") {
+			c.planUpdate()
+			return
+		}
+
+		c.send(c.t(locale.UpdatingElo))
 
 		if err := UpdateGuildElo(s, m.GuildID); err != nil {
-			s.ChannelMessageSend(m.ChannelID, "Elo failed to update.") //nolint:errcheck
+			c.send(c.t(locale.EloUpdateFailed))
 			log.Printf("error updating elo: %v\n", err)
 			return
 		}
 
-		s.ChannelMessageSend(m.ChannelID, "Elo updated!") //nolint:errcheck
+		c.send(c.t(locale.EloUpdated))
+
+	case "eloinfo":
+		cmdMutex.Lock()
+		defer cmdMutex.Unlock()
+
+		c.getElo()
+
+	case "syncroles":
+		c.syncRoles()
 
-	case // !eloInfo
-		lowerTrimmedMessage == "!eloinfo",
-		strings.HasPrefix(lowerTrimmedMessage, "!eloinfo "),
-		lowerTrimmedMessage == "!info",
-		strings.HasPrefix(lowerTrimmedMessage, "!info "),
-		lowerTrimmedMessage == "!i",
-		strings.HasPrefix(lowerTrimmedMessage, "!i "),
-		lowerTrimmedMessage == "!stats",
-		strings.HasPrefix(lowerTrimmedMessage, "!stats "),
-		lowerTrimmedMessage == "!s",
-		strings.HasPrefix(lowerTrimmedMessage, "!s "):
+	case "failing":
+		c.listFailing()
 
+	case "export":
+		c.exportRegistrations()
+
+	case "import":
 		cmdMutex.Lock()
 		defer cmdMutex.Unlock()
 
-		getElo(s, m, dedupedMessage)
+		c.importRegistrations()
+
+	case "audit":
+		c.showAudit()
+
+	case "language":
+		c.setLocale()
+
+	case "serverlanguage":
+		c.setServerLocale()
 
-	case // !help
-		lowerTrimmedMessage == "!help",
-		lowerTrimmedMessage == "!h":
+	case "prefix":
+		c.setPrefix()
 
-		s.ChannelMessageSend(m.ChannelID, usageString) //nolint:errcheck
+	case "mentionprefix":
+		c.setMentionPrefix()
+
+	case "permissions":
+		c.setPermissions()
+
+	case "digest":
+		c.setDigestChannel()
+
+	case "help":
+		c.send(c.usage())
 	}
 }
 
-func setEloInfo(s *discordgo.Session, m *discordgo.MessageCreate, dedupedMessage string) {
-	setEloInfoError := func() {
-		s.ChannelMessageSendReply( //nolint:errcheck
-			m.ChannelID,
-			fmt.Sprint("Your AOE4 info failed to update.\n", usageString),
-			m.Reference())
-		log.Printf("error updating info: %v\n", fmt.Errorf("invalid input for info: %s", m.Content))
+// t returns the message specified by key in the locale of the command.
+func (c *command) t(key string, args ...interface{}) string {
+	return locale.Get(c.lang, key, args...)
+}
+
+func (c *command) usage() string {
+	return c.t(locale.Usage, c.prefix)
+}
+
+// send sends msg to the channel the command was sent in.
+func (c *command) send(msg string) {
+	c.s.ChannelMessageSend(c.m.ChannelID, msg) //nolint:errcheck
+}
+
+// reply sends msg to the channel the command was sent in as a reply to the command message.
+func (c *command) reply(msg string) {
+	c.s.ChannelMessageSendReply(c.m.ChannelID, msg, c.m.Reference()) //nolint:errcheck
+}
+
+// maxMessageLength is the maximum number of characters in a Discord message.
+const maxMessageLength = 2000
+
+// replyLong replies with msg, split at line breaks into as many messages as needed to fit Discord's length limit.
+// Mentions in msg do not notify anyone, since long messages are listings.
+func (c *command) replyLong(msg string) {
+	sendLong(c.s, c.m.ChannelID, msg, c.m.Reference())
+}
+
+// sendLong sends msg to the channel specified by channelId, split at line breaks into as many messages
+// as needed to fit Discord's length limit, each replying to reference if it is not nil.
+// Mentions in msg do not notify anyone.
+func sendLong(s *discordgo.Session, channelId string, msg string, reference *discordgo.MessageReference) {
+	send := func(content string) {
+		s.ChannelMessageSendComplex(channelId, &discordgo.MessageSend{ //nolint:errcheck
+			Content:         content,
+			Reference:       reference,
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		})
 	}
 
-	input := strings.SplitN(dedupedMessage, " ", 2)
-	if len(input) <= 1 {
-		setEloInfoError()
+	var builder strings.Builder
+	for _, line := range strings.SplitAfter(msg, "\n") {
+		if builder.Len()+len(line) > maxMessageLength && builder.Len() != 0 {
+			send(builder.String())
+			builder.Reset()
+		}
+		if len(line) > maxMessageLength {
+			line = line[:maxMessageLength]
+		}
+		builder.WriteString(line)
+	}
+	if builder.Len() != 0 {
+		send(builder.String())
+	}
+}
+
+// replyUsage replies with the message specified by key followed by the usage string.
+func (c *command) replyUsage(key string) {
+	c.reply(fmt.Sprint(c.t(key), c.usage()))
+}
+
+// args returns the arguments of the command, or an empty string if there are none.
+func (c *command) args() string {
+	_, args, _ := strings.Cut(c.dedupedMessage, " ")
+	return args
+}
+
+// trimCommandPrefix removes the guild's command prefix, or a mention of the bot if mention prefixes
+// are enabled, from the start of content. It reports whether content started with either.
+func trimCommandPrefix(s *discordgo.Session, content string, settings *db.GuildSettings) (string, bool) {
+	if settings.MentionPrefix {
+		for _, mention := range [...]string{"<@" + s.State.User.ID + ">", "<@!" + s.State.User.ID + ">"} {
+			if strings.HasPrefix(content, mention) {
+				return strings.TrimSpace(strings.TrimPrefix(content, mention)), true
+			}
+		}
+	}
+
+	if settings.Prefix == "" || !strings.HasPrefix(content, settings.Prefix) {
+		return "", false
+	}
+
+	return strings.TrimPrefix(content, settings.Prefix), true
+}
+
+func getGuildSettings(guildId string) (*db.GuildSettings, error) {
+	cfg := config.Get()
+	guildSettingsCache.RLock()
+	settings, ok := guildSettingsCache.settings[guildId]
+	ok = ok && guildSettingsCache.cfg == cfg && time.Since(guildSettingsCache.fetchedAt[guildId]) < guildCacheTTL
+	guildSettingsCache.RUnlock()
+	if ok {
+		return settings, nil
+	}
+
+	settings, err := db.GetGuildSettings(guildId)
+	if err != nil {
+		return nil, err
+	}
+
+	guildSettingsCache.Lock()
+	if guildSettingsCache.cfg != cfg {
+		guildSettingsCache.settings = make(map[string]*db.GuildSettings)
+		guildSettingsCache.fetchedAt = make(map[string]time.Time)
+		guildSettingsCache.cfg = cfg
+	}
+	guildSettingsCache.settings[guildId] = settings
+	guildSettingsCache.fetchedAt[guildId] = time.Now()
+	guildSettingsCache.Unlock()
+
+	return settings, nil
+}
+
+func invalidateGuildSettings(guildId string) {
+	guildSettingsCache.Lock()
+	delete(guildSettingsCache.settings, guildId)
+	delete(guildSettingsCache.fetchedAt, guildId)
+	guildSettingsCache.Unlock()
+}
+
+// guildLocale returns the default locale of the guild specified by guildId.
+func guildLocale(guildId string) string {
+	settings, err := getGuildSettings(guildId)
+	if err != nil {
+		log.Printf("error getting settings for guild %s: %v\n", guildId, err)
+		return config.Get().Locale
+	}
+
+	return settings.Locale
+}
+
+// isAdmin reports whether the member specified by userId has one of the configured admin roles.
+func isAdmin(s *discordgo.Session, guildId string, userId string) (bool, error) {
+	member, err := getMember(s, guildId, userId)
+	if err != nil {
+		return false, err
+	}
+
+	for _, roleId := range member.Roles {
+		if config.Get().AdminRolesMap[roleId] {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (c *command) setPrefix() {
+	newPrefix := c.args()
+	if newPrefix == "" {
+		c.reply(fmt.Sprint(c.t(locale.CurrentPrefix, c.prefix), c.usage()))
+		return
+	}
+
+	if err := db.SetGuildPrefix(c.m.GuildID, newPrefix); err != nil {
+		c.reply(c.t(locale.PrefixUpdateFailed))
+		log.Printf("error setting prefix: %v\n", err)
 		return
 	}
+	invalidateGuildSettings(c.m.GuildID)
 
-	var mention string
-	var infoInput []string
-	if !strings.HasPrefix(input[1], "<@") {
-		infoInput = strings.Split(input[1], ",")
+	c.reply(c.t(locale.PrefixUpdated, newPrefix))
+}
+
+func (c *command) setMentionPrefix() {
+	var enabled bool
+	switch strings.ToLower(c.args()) {
+	case "on":
+		enabled = true
+	case "off":
+		enabled = false
+	default:
+		c.replyUsage(locale.MentionPrefixInvalid)
+		return
+	}
+
+	if err := db.SetGuildMentionPrefix(c.m.GuildID, enabled); err != nil {
+		c.reply(c.t(locale.MentionPrefixFailed))
+		log.Printf("error setting mention prefix: %v\n", err)
+		return
+	}
+	invalidateGuildSettings(c.m.GuildID)
+
+	if enabled {
+		c.reply(c.t(locale.MentionPrefixEnabled))
 	} else {
-		targetMember, err := s.State.Member(m.GuildID, m.Author.ID)
-		if err != nil {
-			s.ChannelMessageSendReply( //nolint:errcheck
-				m.ChannelID,
-				fmt.Sprint("Unable to retrieve Elo info.\n", usageString),
-				m.Reference())
-			log.Printf("error getting member %s from state: %v", m.Author.ID, err)
+		c.reply(c.t(locale.MentionPrefixDisabled))
+	}
+}
+
+func (c *command) setLocale() {
+	switch newLocale := strings.ToLower(c.args()); {
+	case newLocale == "":
+		c.reply(c.t(locale.CurrentLocale, c.lang, strings.Join(locale.Locales(), ", ")))
+
+	case newLocale == "reset":
+		if err := db.SetUserLocale(c.m.Author.ID, ""); err != nil {
+			c.reply(c.t(locale.LocaleUpdateFailed))
+			log.Printf("error resetting locale: %v\n", err)
 			return
 		}
+		c.lang = guildLocale(c.m.GuildID)
 
-		var isAdmin bool
-		for _, roleId := range targetMember.Roles {
-			if config.Cfg.AdminRolesMap[roleId] {
-				isAdmin = true
-				break
-			}
-		}
+		c.reply(c.t(locale.LocaleReset))
 
-		if !isAdmin {
-			s.ChannelMessageSendReply( //nolint:errcheck
-				m.ChannelID,
-				fmt.Sprint("Insufficient privileges to set Elo info for another user.\n", usageString),
-				m.Reference())
+	case !locale.Supported(newLocale):
+		c.reply(c.t(locale.LocaleUnsupported, newLocale, strings.Join(locale.Locales(), ", ")))
+
+	default:
+		if err := db.SetUserLocale(c.m.Author.ID, newLocale); err != nil {
+			c.reply(c.t(locale.LocaleUpdateFailed))
+			log.Printf("error setting locale: %v\n", err)
 			return
 		}
-		fullInfoInput := strings.SplitN(input[1], " ", 2)
-		if len(fullInfoInput) <= 1 {
-			setEloInfoError()
+		c.lang = newLocale
+
+		c.reply(c.t(locale.LocaleUpdated, newLocale))
+	}
+}
+
+func (c *command) setServerLocale() {
+	newLocale := strings.ToLower(c.args())
+	if !locale.Supported(newLocale) {
+		c.reply(c.t(locale.LocaleUnsupported, newLocale, strings.Join(locale.Locales(), ", ")))
+		return
+	}
+
+	if err := db.SetGuildLocale(c.m.GuildID, newLocale); err != nil {
+		c.reply(c.t(locale.LocaleUpdateFailed))
+		log.Printf("error setting server locale: %v\n", err)
+		return
+	}
+	invalidateGuildSettings(c.m.GuildID)
+
+	c.reply(c.t(locale.ServerLocaleUpdated, newLocale))
+}
+
+// targetUser splits an optional leading user mention from args. Targeting another user, who must be a member
+// of the guild, requires the manageusers permission, which is admin only by default.
+// It returns the ID and mention of the target user and the remaining args, or replies with an error
+// and returns false if the author is not allowed to target the mentioned user.
+func (c *command) targetUser(args string) (userId string, mention string, rest string, ok bool) {
+	if !strings.HasPrefix(args, "<@") {
+		return c.m.Author.ID, c.m.Author.Mention(), args, true
+	}
+
+	if permitted, disabled := c.permitted("manageusers"); disabled {
+		c.reply(c.t(locale.CommandDisabled))
+		return "", "", "", false
+	} else if !permitted {
+		c.replyUsage(locale.SetOtherUserForbidden)
+		return "", "", "", false
+	}
+
+	mention, rest, _ = strings.Cut(args, " ")
+	userId = strings.Trim(mention, "<@!>")
+	if _, err := getMember(c.s, c.m.GuildID, userId); err != nil {
+		c.replyUsage(locale.TargetNotMember)
+		log.Println(err)
+		return "", "", "", false
+	}
+
+	return userId, mention, rest, true
+}
+
+func (c *command) syncRoles() {
+	created, updated, err := SyncGuildRoles(c.s, c.m.GuildID)
+	if err != nil {
+		c.reply(c.t(locale.RolesSyncFailed, created, updated))
+		log.Printf("error syncing elo roles: %v\n", err)
+		return
+	}
+
+	c.reply(c.t(locale.RolesSynced, created, updated))
+}
+
+func (c *command) listFailing() {
+	cfg := config.Get()
+	threshold := cfg.FailureThreshold
+	if args := c.args(); args != "" {
+		n, err := strconv.Atoi(args)
+		if err != nil || n < 1 {
+			c.replyUsage(locale.EloInfoFailed)
 			return
 		}
-		mention = fullInfoInput[0]
-		infoInput = strings.Split(fullInfoInput[1], ",")
+		threshold = n
+	}
+
+	users, err := db.GetUsers(c.m.GuildID)
+	if err != nil {
+		c.replyUsage(locale.EloInfoFailed)
+		log.Printf("error getting users: %v\n", err)
+		return
 	}
+
+	var builder strings.Builder
+	for i := range users {
+		u := (*user)(&users[i])
+		failures, lastError := u.failures(cfg)
+		if failures < threshold {
+			continue
+		}
+		builder.WriteString(c.t(locale.FailingEntry,
+			"<@"+u.DiscordUserID+">", u.Aoe4Username, u.Aoe4Id, failures, lastError))
+	}
+
+	if builder.Len() == 0 {
+		c.reply(c.t(locale.FailingNone, threshold))
+		return
+	}
+
+	c.replyLong(c.t(locale.FailingHeader, threshold) + builder.String())
+}
+
+func (c *command) setEloInfo() {
+	setEloInfoError := func() {
+		c.replyUsage(locale.InfoUpdateFailed)
+		log.Printf("error updating info: %v\n", fmt.Errorf("invalid input for info: %s", c.m.Content))
+	}
+
+	userId, mention, args, ok := c.targetUser(c.args())
+	if !ok {
+		return
+	}
+
+	infoInput := strings.Split(args, ",")
 	if len(infoInput) <= 1 {
 		setEloInfoError()
 		return
 	}
 
 	aoe4Username, aoe4Id := strings.TrimSpace(infoInput[0]), strings.TrimSpace(infoInput[1])
-
-	sendUpdateMessage := func(mention string) {
-		s.ChannelMessageSendReply( //nolint:errcheck
-			m.ChannelID,
-			fmt.Sprintf("%s's AOE4 username has been updated to %s and ID has been updated to %s.",
-				mention,
-				aoe4Username,
-				aoe4Id),
-			m.Reference())
+	if aoe4Username == "" || aoe4Id == "" {
+		setEloInfoError()
+		return
 	}
 
-	if mention == "" {
-		if err := db.RegisterUser(aoe4Username, aoe4Id, m.Author.ID, m.GuildID); err != nil {
-			setEloInfoError()
-			return
+	var oldAccount string
+	if users, err := db.GetUser(userId); err == nil {
+		for _, u := range users {
+			if u.Aoe4Id == aoe4Id {
+				oldAccount = accountValue(u.Aoe4Username, u.Aoe4Id)
+			}
 		}
+	}
 
-		sendUpdateMessage(m.Author.Mention())
-	} else {
-		if err := db.RegisterUser(aoe4Username, aoe4Id, strings.Trim(mention, "<@>"), m.GuildID); err != nil {
-			setEloInfoError()
-			return
-		}
+	// Links made for another member are shared by all guilds, and are audited with the author as actor.
+	if err := db.LinkAccount(aoe4Username, aoe4Id, userId); err != nil {
+		setEloInfoError()
+		log.Println(err)
+		return
+	}
+	if err := db.JoinGuild(userId, c.m.GuildID); err != nil {
+		setEloInfoError()
+		log.Println(err)
+		return
+	}
+
+	c.audit(userId, db.AuditLink, oldAccount, accountValue(aoe4Username, aoe4Id))
+	c.reply(c.t(locale.InfoUpdated, mention, aoe4Username, aoe4Id))
+}
+
+func (c *command) unlinkAccount() {
+	userId, mention, aoe4Id, ok := c.targetUser(c.args())
+	if !ok {
+		return
+	}
+	if aoe4Id == "" {
+		c.replyUsage(locale.AccountUpdateFailed)
+		return
+	}
+
+	if err := db.UnlinkAccount(userId, aoe4Id); errors.Is(err, db.ErrAccountNotFound) {
+		c.replyUsage(locale.AccountNotFound)
+		return
+	} else if err != nil {
+		c.replyUsage(locale.AccountUpdateFailed)
+		log.Printf("error unlinking account: %v\n", err)
+		return
+	}
+
+	c.audit(userId, db.AuditUnlink, aoe4Id, "")
+	c.reply(c.t(locale.AccountUnlinked, mention, aoe4Id))
+}
+
+func (c *command) setPrimaryAccount() {
+	userId, mention, aoe4Id, ok := c.targetUser(c.args())
+	if !ok {
+		return
+	}
+	if aoe4Id == "" {
+		c.replyUsage(locale.AccountUpdateFailed)
+		return
+	}
+
+	var oldPrimary string
+	if users, err := db.GetUser(userId); err == nil && users[0].IsPrimary {
+		oldPrimary = users[0].Aoe4Id
+	}
+
+	if err := db.SetPrimaryAccount(userId, aoe4Id); errors.Is(err, db.ErrAccountNotFound) {
+		c.replyUsage(locale.AccountNotFound)
+		return
+	} else if err != nil {
+		c.replyUsage(locale.AccountUpdateFailed)
+		log.Printf("error setting primary account: %v\n", err)
+		return
+	}
+
+	c.audit(userId, db.AuditPrimary, oldPrimary, aoe4Id)
+	c.reply(c.t(locale.PrimaryAccountSet, mention, aoe4Id))
+}
 
-		sendUpdateMessage(mention)
+func (c *command) optIn() {
+	if _, err := db.GetUser(c.m.Author.ID); errors.Is(err, db.ErrAccountNotFound) {
+		c.replyUsage(locale.NotRegistered)
+		return
+	} else if err != nil {
+		c.replyUsage(locale.AccountUpdateFailed)
+		log.Printf("error getting user: %v\n", err)
+		return
 	}
+
+	if err := db.JoinGuild(c.m.Author.ID, c.m.GuildID); err != nil {
+		c.replyUsage(locale.AccountUpdateFailed)
+		log.Printf("error opting in: %v\n", err)
+		return
+	}
+
+	c.audit(c.m.Author.ID, db.AuditOptIn, "", "")
+	c.reply(c.t(locale.OptedIn))
 }
 
-func getElo(s *discordgo.Session, m *discordgo.MessageCreate, dedupedMessage string) {
+func (c *command) optOut() {
+	if err := db.LeaveGuild(c.m.Author.ID, c.m.GuildID); errors.Is(err, db.ErrNotInGuild) {
+		c.reply(fmt.Sprint(c.t(locale.NotOptedIn, c.prefix), c.usage()))
+		return
+	} else if err != nil {
+		c.replyUsage(locale.AccountUpdateFailed)
+		log.Printf("error opting out: %v\n", err)
+		return
+	}
+
+	c.audit(c.m.Author.ID, db.AuditOptOut, "", "")
+
+	if err := removeMemberEloRoles(c.s, c.m.GuildID, c.m.Author.ID); err != nil {
+		log.Printf("error removing elo roles: %v\n", err)
+	}
+
+	c.reply(c.t(locale.OptedOut))
+}
+
+func (c *command) setVisibility() {
+	var visible bool
+	switch strings.ToLower(c.args()) {
+	case "public":
+		visible = true
+	case "private":
+		visible = false
+	default:
+		c.replyUsage(locale.VisibilityInvalid)
+		return
+	}
+
+	if err := db.SetGuildVisibility(c.m.Author.ID, c.m.GuildID, visible); errors.Is(err, db.ErrNotInGuild) {
+		c.reply(fmt.Sprint(c.t(locale.NotOptedIn, c.prefix), c.usage()))
+		return
+	} else if err != nil {
+		c.replyUsage(locale.AccountUpdateFailed)
+		log.Printf("error setting visibility: %v\n", err)
+		return
+	}
+
+	c.audit(c.m.Author.ID, db.AuditVisibility, "", strings.ToLower(c.args()))
+
+	if visible {
+		c.reply(c.t(locale.VisibilityPublic))
+	} else {
+		c.reply(c.t(locale.VisibilityPrivate))
+	}
+}
+
+func (c *command) getElo() {
 	eloInfoError := func() {
-		s.ChannelMessageSendReply( //nolint:errcheck
-			m.ChannelID,
-			fmt.Sprint("Unable to retrieve Elo info.\n", usageString),
-			m.Reference())
+		c.replyUsage(locale.EloInfoFailed)
 	}
 
-	input := strings.SplitN(dedupedMessage, " ", 2)
-	var err error
-	var u *db.User
-	var targetName string
-	if len(input) == 1 {
-		u, err = db.GetUser(m.Author.ID, m.GuildID)
-		if err != nil {
-			s.ChannelMessageSendReply( //nolint:errcheck
-				m.ChannelID,
-				fmt.Sprint("You are not registered.\n", usageString),
-				m.Reference())
-			log.Printf("error getting info: %v\n", err)
+	var targetId string
+	var force bool
+	for _, arg := range strings.Fields(c.args()) {
+		switch {
+		case strings.EqualFold(arg, "--force") && !force:
+			force = true
+		case strings.HasPrefix(arg, "<@") && targetId == "":
+			targetId = strings.Trim(arg, "<@!>")
+		default:
+			eloInfoError()
+			log.Printf("error getting info: %v\n", fmt.Errorf("invalid input for info: %s", c.m.Content))
 			return
 		}
+	}
+	if targetId == "" {
+		targetId = c.m.Author.ID
+	}
+	// Bypassing the rating cache queries the leaderboard again, so it is admin only by default.
+	if force && !c.allowed("forceupdate") {
+		return
+	}
 
-		if m.Member.Nick != "" {
-			targetName = m.Member.Nick
+	users, err := db.GetUser(targetId)
+	if err != nil {
+		if targetId == c.m.Author.ID {
+			c.replyUsage(locale.NotRegistered)
 		} else {
-			targetName = m.Author.Username
-		}
-	} else if len(input) == 2 {
-		if !strings.HasPrefix(input[1], "<@") {
-			eloInfoError()
-			log.Printf("error updating member elo: %v\n", fmt.Errorf("invalid input"))
-			return
+			c.replyUsage(locale.UserNotRegistered)
 		}
+		log.Printf("error getting info: %v\n", err)
+		return
+	}
 
-		u, err = db.GetUser(strings.Trim(input[1], "<@>"), m.GuildID)
-		if err != nil {
-			s.ChannelMessageSendReply( //nolint:errcheck
-				m.ChannelID,
-				fmt.Sprint("User is not registered.\n", usageString),
-				m.Reference())
-			log.Printf("error getting info: %v\n", err)
-			return
+	visible, err := db.GetGuildVisibility(targetId, c.m.GuildID)
+	if err != nil {
+		if targetId == c.m.Author.ID {
+			c.reply(fmt.Sprint(c.t(locale.NotOptedIn, c.prefix), c.usage()))
+		} else {
+			c.replyUsage(locale.UserNotRegistered)
 		}
-
-		targetMember, err := s.State.Member(m.GuildID, u.DiscordUserID)
-		if err != nil {
-			eloInfoError()
-			log.Printf("error getting member %s from state: %v", u.DiscordUserID, err)
+		log.Printf("error getting info: %v\n", err)
+		return
+	}
+	if !visible && targetId != c.m.Author.ID {
+		if ok, _ := c.permitted("viewprivate"); !ok {
+			c.replyUsage(locale.UserNotRegistered)
 			return
 		}
+	}
 
-		if targetMember.Nick != "" {
-			targetName = targetMember.Nick
-		} else {
-			targetName = targetMember.User.Username
-		}
-	} else {
+	targetMember, err := getMember(c.s, c.m.GuildID, targetId)
+	if err != nil {
 		eloInfoError()
-		log.Printf("error getting info: %v\n", fmt.Errorf("invalid input for info: %s", m.Content))
+		log.Println(err)
 		return
 	}
 
-	if err := (*user)(u).updateMemberElo(s, m.GuildID); err != nil {
-		eloInfoError()
-		log.Printf("error updating member elo: %v\n", err)
-		return
+	var targetName string
+	if targetMember.Nick != "" {
+		targetName = targetMember.Nick
+	} else {
+		targetName = targetMember.User.Username
+	}
+
+	kind := fetchInteractive
+	if force {
+		kind = fetchForced
+	}
+
+	cfg := config.Get()
+	accs := linkedAccounts(users)
+	for i := range accs {
+		if err := (*user)(&accs[i]).updateMemberElo(cfg, kind); err != nil {
+			eloInfoError()
+			log.Printf("error updating member elo: %v\n", err)
+			return
+		}
 	}
 
-	if err := (*user)(u).updateMemberEloRoles(s, m.GuildID); err != nil {
+	if err := accs.updateMemberEloRoles(cfg, c.s, c.m.GuildID); err != nil {
 		log.Printf("error getting member elo: %v", err)
 		return
 	}
 
-	s.ChannelMessageSendReply( //nolint:errcheck
-		m.ChannelID,
-		(*user)(u).EloString(targetName),
-		m.Reference())
+	baselines, err := accs.ratingBaselines(cfg, c.m.GuildID)
+	if err != nil {
+		// The Elo values are still worth showing without their changes.
+		log.Printf("error getting rating baselines: %v\n", err)
+	}
+
+	c.reply(accs.EloString(cfg, targetName, c.lang, baselines))
 }
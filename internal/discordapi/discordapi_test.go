@@ -0,0 +1,41 @@
+package discordapi
+
+import (
+	"testing"
+
+	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/db"
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestTrimCommandPrefix(t *testing.T) {
+	s := &discordgo.Session{State: discordgo.NewState()}
+	s.State.User = &discordgo.User{ID: "100000000000000001"}
+
+	tests := []struct {
+		name     string
+		content  string
+		settings db.GuildSettings
+		want     string
+		ok       bool
+	}{
+		{"prefix", "!elo", db.GuildSettings{Prefix: "!"}, "elo", true},
+		{"multi-character prefix", "elo!update now", db.GuildSettings{Prefix: "elo!"}, "update now", true},
+		{"other prefix", "?elo", db.GuildSettings{Prefix: "!"}, "", false},
+		{"no prefix", "elo", db.GuildSettings{Prefix: "!"}, "", false},
+		{"empty prefix", "elo", db.GuildSettings{}, "", false},
+		{"mention", "<@100000000000000001> elo", db.GuildSettings{Prefix: "!", MentionPrefix: true}, "elo", true},
+		{"nickname mention", "<@!100000000000000001>  elo", db.GuildSettings{MentionPrefix: true}, "elo", true},
+		{"mention disabled", "<@100000000000000001> elo", db.GuildSettings{Prefix: "!"}, "", false},
+		{"mention of another user", "<@100000000000000002> elo", db.GuildSettings{MentionPrefix: true}, "", false},
+		{"prefix with mention enabled", "!elo", db.GuildSettings{Prefix: "!", MentionPrefix: true}, "elo", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := trimCommandPrefix(s, tt.content, &tt.settings)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("trimCommandPrefix(%q) = %q, %v, want %q, %v", tt.content, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package discordapi
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/db"
+	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/export"
+	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/locale"
+	"github.com/bwmarrin/discordgo"
+)
+
+// maxImportSize is the maximum size in bytes of an imported file.
+const maxImportSize = 8 << 20
+
+var attachmentClient = &http.Client{Timeout: 30 * time.Second}
+
+// exportRegistrations replies with a file containing the registrations and ratings of the guild.
+func (c *command) exportRegistrations() {
+	format := strings.ToLower(c.args())
+	if format == "" {
+		format = export.FormatJSON
+	}
+	if format != export.FormatJSON && format != export.FormatCSV {
+		c.replyUsage(locale.ExportFailed)
+		return
+	}
+
+	regs, err := db.ExportRegistrations(c.m.GuildID)
+	if err != nil {
+		c.reply(c.t(locale.ExportFailed))
+		log.Printf("error exporting registrations: %v\n", err)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := export.Write(&buf, regs, format); err != nil {
+		c.reply(c.t(locale.ExportFailed))
+		log.Printf("error exporting registrations: %v\n", err)
+		return
+	}
+
+	c.s.ChannelMessageSendComplex(c.m.ChannelID, &discordgo.MessageSend{ //nolint:errcheck
+		Files: []*discordgo.File{{
+			Name:   fmt.Sprintf("aoe4elobot-%s-%s.%s", c.m.GuildID, time.Now().Format("2006-01-02"), format),
+			Reader: &buf,
+		}},
+		Reference: c.m.Reference(),
+	})
+}
+
+// importRegistrations opts in the members of an attached export to the guild, replacing the visibility of members
+// who already opted in if overwrite is given. Linked accounts and ratings are shared by all guilds, so they are
+// only imported with the CLI and never changed from a guild.
+func (c *command) importRegistrations() {
+	var overwrite bool
+	switch strings.ToLower(c.args()) {
+	case "", "skip":
+	case "overwrite":
+		overwrite = true
+	default:
+		c.replyUsage(locale.ImportNoAttachment)
+		return
+	}
+
+	if len(c.m.Attachments) == 0 {
+		c.replyUsage(locale.ImportNoAttachment)
+		return
+	}
+	attachment := c.m.Attachments[0]
+	if attachment.Size > maxImportSize {
+		c.reply(c.t(locale.ImportFailed, "file too large"))
+		return
+	}
+
+	regs, err := readAttachment(attachment)
+	if err != nil {
+		c.reply(c.t(locale.ImportFailed, err))
+		log.Printf("error reading import file: %v\n", err)
+		return
+	}
+
+	regs, ignored := export.FilterGuild(regs, c.m.GuildID)
+	imported, skipped, err := db.ImportGuildMemberships(c.m.GuildID, regs, overwrite)
+	if err != nil {
+		c.reply(c.t(locale.ImportFailed, err))
+		log.Printf("error importing registrations: %v\n", err)
+		return
+	}
+
+	log.Printf("%d registrations imported on guild %s by %s", imported, c.m.GuildID, c.m.Author.ID)
+	c.audit(c.m.Author.ID, db.AuditImport, "", fmt.Sprintf("%d imported, %d skipped", imported, skipped))
+	c.reply(c.t(locale.Imported, imported, skipped, ignored))
+}
+
+func readAttachment(attachment *discordgo.MessageAttachment) ([]db.Registration, error) {
+	resp, err := attachmentClient.Get(attachment.URL)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading attachment: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error downloading attachment: %s", resp.Status)
+	}
+
+	return export.Read(io.LimitReader(resp.Body, maxImportSize), export.FormatFromName(attachment.Filename))
+}
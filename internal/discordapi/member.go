@@ -0,0 +1,103 @@
+package discordapi
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// memberChunkTimeout is how long updates wait for the members of a guild requested from the gateway.
+const memberChunkTimeout = time.Minute
+
+// memberChunks holds a channel for each guild whose members were requested from the gateway,
+// which is closed once all of them were received.
+var memberChunks = struct {
+	pending map[string]chan struct{}
+	sync.Mutex
+}{pending: make(map[string]chan struct{})}
+
+// getMember returns the member specified by userId from the state, or from the REST API if the state
+// does not hold it, in which case the member is added to the state.
+func getMember(s *discordgo.Session, guildId string, userId string) (*discordgo.Member, error) {
+	member, err := s.State.Member(guildId, userId)
+	if err == nil {
+		return member, nil
+	} else if !errors.Is(err, discordgo.ErrStateNotFound) {
+		return nil, fmt.Errorf("error getting member %s from state: %w", userId, err)
+	}
+
+	member, err = s.GuildMember(guildId, userId)
+	if err != nil {
+		return nil, fmt.Errorf("error getting member %s of guild %s: %w", userId, guildId, err)
+	}
+	member.GuildID = guildId
+	// The guild itself may be missing from the state, in which case the member is not cached.
+	s.State.MemberAdd(member) //nolint:errcheck
+
+	return member, nil
+}
+
+// requestGuildMembers asks the gateway for all members of g, unless the state already holds all of them.
+// The members are added to the state as they are received. A guild whose members are still pending
+// is requested again, as the chunks of the previous request may have been lost with its connection.
+func requestGuildMembers(s *discordgo.Session, g *discordgo.Guild) {
+	if !s.State.TrackMembers || g.MemberCount <= len(g.Members) {
+		return
+	}
+
+	memberChunks.Lock()
+	if _, ok := memberChunks.pending[g.ID]; !ok {
+		memberChunks.pending[g.ID] = make(chan struct{})
+	}
+	memberChunks.Unlock()
+
+	if err := s.RequestGuildMembers(g.ID, "", 0, "", false); err != nil {
+		log.Printf("error requesting members of guild %s: %v\n", g.ID, err)
+		membersReceived(g.ID)
+	}
+}
+
+// GuildMembersChunk is the handler for Discordgo GuildMembersChunk events.
+// It records when all members requested for a guild were received.
+func GuildMembersChunk(s *discordgo.Session, c *discordgo.GuildMembersChunk) {
+	if c.ChunkIndex == c.ChunkCount-1 {
+		membersReceived(c.GuildID)
+	}
+}
+
+func membersReceived(guildId string) {
+	memberChunks.Lock()
+	if done, ok := memberChunks.pending[guildId]; ok {
+		close(done)
+		delete(memberChunks.pending, guildId)
+	}
+	memberChunks.Unlock()
+}
+
+// waitForMembers waits until all members requested for the guild specified by guildId were received,
+// or until timeout elapses.
+func waitForMembers(guildId string, timeout time.Duration) {
+	memberChunks.Lock()
+	done, ok := memberChunks.pending[guildId]
+	memberChunks.Unlock()
+	if !ok {
+		return
+	}
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		log.Printf("timed out waiting for members of guild %s\n", guildId)
+		// The members are not waited for again until they are requested again.
+		memberChunks.Lock()
+		if memberChunks.pending[guildId] == done {
+			close(done)
+			delete(memberChunks.pending, guildId)
+		}
+		memberChunks.Unlock()
+	}
+}
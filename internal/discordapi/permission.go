@@ -0,0 +1,361 @@
+package discordapi
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/db"
+	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/locale"
+	"github.com/bwmarrin/discordgo"
+)
+
+// commandNames holds the names of all commands.
+var commandNames = [...]string{
+	"seteloinfo", "unlink", "primary", "optin", "optout", "visibility", "updateelo", "eloinfo",
+	"syncroles", "failing", "export", "import", "audit", "digest",
+	"language", "serverlanguage", "prefix", "mentionprefix", "permissions", "help",
+}
+
+// commandAliases maps each command alias to the name of the command it runs.
+var commandAliases = map[string]string{
+	"set":    "seteloinfo",
+	"link":   "seteloinfo",
+	"update": "updateelo",
+	"u":      "updateelo",
+	"info":   "eloinfo",
+	"i":      "eloinfo",
+	"stats":  "eloinfo",
+	"s":      "eloinfo",
+	"lang":   "language",
+	"h":      "help",
+}
+
+// actionNames holds the names of actions within commands that have permission rules of their own.
+var actionNames = [...]string{
+	// manageusers opts another member in with an account they linked.
+	"manageusers",
+	// forceupdate retrieves ratings with eloInfo --force, bypassing the rating cache.
+	"forceupdate",
+	// viewprivate shows the Elo of members with a private visibility.
+	"viewprivate",
+}
+
+// adminCommands holds the commands and actions that only admins can use on guilds without permission rules
+// for them.
+var adminCommands = map[string]bool{
+	"updateelo":      true,
+	"manageusers":    true,
+	"forceupdate":    true,
+	"viewprivate":    true,
+	"syncroles":      true,
+	"failing":        true,
+	"export":         true,
+	"import":         true,
+	"audit":          true,
+	"digest":         true,
+	"serverlanguage": true,
+	"prefix":         true,
+	"mentionprefix":  true,
+}
+
+// permissionNames maps the names accepted for permission rules to Discord permission bits.
+var permissionNames = map[string]int64{
+	"administrator":   discordgo.PermissionAdministrator,
+	"manageserver":    discordgo.PermissionManageServer,
+	"manageroles":     discordgo.PermissionManageRoles,
+	"managechannels":  discordgo.PermissionManageChannels,
+	"managemessages":  discordgo.PermissionManageMessages,
+	"kickmembers":     discordgo.PermissionKickMembers,
+	"banmembers":      discordgo.PermissionBanMembers,
+	"moderatemembers": discordgo.PermissionModerateMembers,
+	"mentioneveryone": discordgo.PermissionMentionEveryone,
+}
+
+var commandRulesCache = struct {
+	rules     map[string]map[string][]db.CommandRule
+	fetchedAt map[string]time.Time
+	sync.RWMutex
+}{rules: make(map[string]map[string][]db.CommandRule), fetchedAt: make(map[string]time.Time)}
+
+// commandName returns the name of the command run by the command or alias specified by name.
+func commandName(name string) string {
+	if cmd, ok := commandAliases[name]; ok {
+		return cmd
+	}
+
+	return name
+}
+
+func isCommand(name string) bool {
+	for _, cmd := range commandNames {
+		if cmd == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isAction(name string) bool {
+	for _, action := range actionNames {
+		if action == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func getCommandRules(guildId string) (map[string][]db.CommandRule, error) {
+	commandRulesCache.RLock()
+	rules, ok := commandRulesCache.rules[guildId]
+	ok = ok && time.Since(commandRulesCache.fetchedAt[guildId]) < guildCacheTTL
+	commandRulesCache.RUnlock()
+	if ok {
+		return rules, nil
+	}
+
+	rules, err := db.GetCommandRules(guildId)
+	if err != nil {
+		return nil, err
+	}
+
+	commandRulesCache.Lock()
+	commandRulesCache.rules[guildId] = rules
+	commandRulesCache.fetchedAt[guildId] = time.Now()
+	commandRulesCache.Unlock()
+
+	return rules, nil
+}
+
+func invalidateCommandRules(guildId string) {
+	commandRulesCache.Lock()
+	delete(commandRulesCache.rules, guildId)
+	delete(commandRulesCache.fetchedAt, guildId)
+	commandRulesCache.Unlock()
+}
+
+// allowed reports whether the author of the command can run the command or action specified by name, replying
+// with an error if not.
+func (c *command) allowed(name string) bool {
+	ok, disabled := c.permitted(name)
+	switch {
+	case disabled:
+		c.reply(c.t(locale.CommandDisabled))
+	case !ok:
+		c.replyUsage(locale.InsufficientPrivileges)
+	}
+
+	return ok
+}
+
+// permitted reports whether the author of the command can run the command or action specified by name,
+// and whether it is disabled on the guild. Commands and actions without permission rules on the guild
+// are open to everyone, except adminCommands. Admins can run anything that is not disabled,
+// and the permissions command is always admin only.
+func (c *command) permitted(name string) (ok bool, disabled bool) {
+	if name == "permissions" {
+		admin, err := isAdmin(c.s, c.m.GuildID, c.m.Author.ID)
+		if err != nil {
+			log.Println(err)
+		}
+		return admin, false
+	}
+
+	guildRules, err := getCommandRules(c.m.GuildID)
+	if err != nil {
+		log.Printf("error getting command permissions for guild %s: %v\n", c.m.GuildID, err)
+		return false, false
+	}
+	rules := guildRules[name]
+
+	for _, rule := range rules {
+		if rule.Rule == db.RuleDisabled {
+			return false, true
+		}
+	}
+
+	// Open commands are checked first, as looking up whether the author is an admin may need a request.
+	if len(rules) == 0 && !adminCommands[name] {
+		return true, false
+	}
+
+	admin, err := isAdmin(c.s, c.m.GuildID, c.m.Author.ID)
+	if err != nil {
+		log.Println(err)
+	}
+	if admin {
+		return true, false
+	}
+
+	return c.matchesRule(rules), false
+}
+
+// matchesRule reports whether the author of the command matches any of rules.
+func (c *command) matchesRule(rules []db.CommandRule) bool {
+	var roles map[string]bool
+	var permissions int64
+	if member, err := getMember(c.s, c.m.GuildID, c.m.Author.ID); err != nil {
+		log.Println(err)
+	} else {
+		roles = make(map[string]bool, len(member.Roles))
+		for _, roleId := range member.Roles {
+			roles[roleId] = true
+		}
+	}
+	if perms, err := c.s.State.UserChannelPermissions(c.m.Author.ID, c.m.ChannelID); err != nil {
+		log.Printf("error getting permissions of member %s: %v\n", c.m.Author.ID, err)
+	} else {
+		permissions = perms
+	}
+
+	for _, rule := range rules {
+		switch rule.Rule {
+		case db.RuleRole:
+			if roles[rule.Value] {
+				return true
+			}
+		case db.RuleUser:
+			if rule.Value == c.m.Author.ID {
+				return true
+			}
+		case db.RulePermission:
+			bit, err := strconv.ParseInt(rule.Value, 10, 64)
+			if err == nil && (permissions&bit == bit || permissions&discordgo.PermissionAdministrator != 0) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// setPermissions shows or changes the permission rules of a command. The arguments are the command name,
+// optionally followed by "allow role @Role", "allow permission NAME", "allow user @User", "disable" or "reset".
+func (c *command) setPermissions() {
+	args := strings.Fields(c.args())
+	if len(args) == 0 {
+		c.replyUsage(locale.PermissionsInvalid)
+		return
+	}
+
+	name := commandName(strings.ToLower(strings.TrimPrefix(args[0], c.prefix)))
+	if name == "permissions" || !(isCommand(name) || isAction(name)) {
+		c.replyUsage(locale.PermissionsInvalid)
+		return
+	}
+
+	var err error
+	switch {
+	case len(args) == 1:
+		c.showPermissions(name)
+		return
+	case len(args) == 2 && strings.EqualFold(args[1], "reset"):
+		err = db.ResetCommandRules(c.m.GuildID, name)
+	case len(args) == 2 && strings.EqualFold(args[1], "disable"):
+		err = db.AddCommandRule(c.m.GuildID, name, db.CommandRule{Rule: db.RuleDisabled})
+	case len(args) >= 4 && strings.EqualFold(args[1], "allow"):
+		rule, ok := parseCommandRule(strings.ToLower(args[2]), strings.Join(args[3:], ""))
+		if !ok {
+			c.replyUsage(locale.PermissionsInvalid)
+			return
+		}
+		err = db.AddCommandRule(c.m.GuildID, name, rule)
+	default:
+		c.replyUsage(locale.PermissionsInvalid)
+		return
+	}
+	if err != nil {
+		c.reply(c.t(locale.PermissionsUpdateFailed))
+		log.Printf("error updating command permissions: %v\n", err)
+		return
+	}
+	invalidateCommandRules(c.m.GuildID)
+
+	c.showPermissions(name)
+}
+
+func parseCommandRule(ruleType string, value string) (db.CommandRule, bool) {
+	switch ruleType {
+	case db.RuleRole:
+		if !strings.HasPrefix(value, "<@&") {
+			return db.CommandRule{}, false
+		}
+		return db.CommandRule{Rule: db.RuleRole, Value: strings.Trim(value, "<@&>")}, true
+	case db.RuleUser:
+		if !strings.HasPrefix(value, "<@") {
+			return db.CommandRule{}, false
+		}
+		return db.CommandRule{Rule: db.RuleUser, Value: strings.Trim(value, "<@!>")}, true
+	case db.RulePermission:
+		bit, ok := permissionNames[strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(value))]
+		if !ok {
+			return db.CommandRule{}, false
+		}
+		return db.CommandRule{Rule: db.RulePermission, Value: strconv.FormatInt(bit, 10)}, true
+	default:
+		return db.CommandRule{}, false
+	}
+}
+
+// showPermissions replies with the permission rules of the command specified by name.
+func (c *command) showPermissions(name string) {
+	guildRules, err := getCommandRules(c.m.GuildID)
+	if err != nil {
+		c.reply(c.t(locale.PermissionsUpdateFailed))
+		log.Printf("error getting command permissions: %v\n", err)
+		return
+	}
+
+	rules := guildRules[name]
+	if len(rules) == 0 {
+		if adminCommands[name] {
+			c.replyLong(c.t(locale.PermissionsDefaultAdmin, name))
+		} else {
+			c.replyLong(c.t(locale.PermissionsDefaultEveryone, name))
+		}
+		return
+	}
+
+	descriptions := make([]string, len(rules))
+	for i, rule := range rules {
+		switch rule.Rule {
+		case db.RuleDisabled:
+			c.reply(c.t(locale.PermissionsDisabled, name))
+			return
+		case db.RuleRole:
+			descriptions[i] = "<@&" + rule.Value + ">"
+		case db.RuleUser:
+			descriptions[i] = "<@" + rule.Value + ">"
+		case db.RulePermission:
+			descriptions[i] = permissionName(rule.Value)
+		default:
+			descriptions[i] = rule.Rule
+		}
+	}
+
+	c.replyLong(c.t(locale.PermissionsList, name, strings.Join(descriptions, ", ")))
+}
+
+// permissionName returns the name of the permission whose bit is given as a string by value.
+func permissionName(value string) string {
+	bit, _ := strconv.ParseInt(value, 10, 64)
+
+	names := make([]string, 0, 1)
+	for name, b := range permissionNames {
+		if b == bit {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return fmt.Sprintf("permission %s", value)
+	}
+	sort.Strings(names)
+
+	return names[0]
+}
@@ -0,0 +1,125 @@
+package discordapi
+
+import (
+	"log"
+	"strings"
+
+	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/config"
+	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/db"
+	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/locale"
+	"github.com/bwmarrin/discordgo"
+)
+
+// A RoleChange is an Elo role change that an update would make.
+type RoleChange struct {
+	UserID string
+	Mode   string
+	// OldRoleID and NewRoleID are empty if the member has no role on the ladder before or after the change.
+	OldRoleID string
+	NewRoleID string
+}
+
+// An UpdatePlan describes the Elo role changes an update would make on a guild.
+type UpdatePlan struct {
+	Promotions []RoleChange
+	// Demotions holds all changes that are not promotions, including roles that would be removed
+	// from unregistered members and duplicate roles on a ladder.
+	Demotions []RoleChange
+	// Untouched is the number of members of the guild whose roles would not change.
+	Untouched int
+	// Missing is the number of registered members that could not be found on the guild.
+	Missing int
+}
+
+// PlanGuildElo retrieves Elo for all users on the guild specified by guildId and returns the Elo role changes
+// an update would make, without storing the retrieved Elo or changing any roles.
+func PlanGuildElo(s *discordgo.Session, guildId string) (*UpdatePlan, error) {
+	cfg := config.Get()
+	guildUsers, err := fetchGuildElo(cfg, []string{guildId}, true)
+	if err != nil {
+		return nil, err
+	}
+
+	members, untouched, missing, err := guildRoleChanges(cfg, guildUsers[guildId], s, guildId)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &UpdatePlan{Untouched: untouched, Missing: missing}
+	for _, m := range members {
+		for _, change := range m.changes {
+			rc := RoleChange{
+				UserID:    m.member.User.ID,
+				Mode:      db.Modes[change.mode],
+				OldRoleID: change.currentRoleId,
+				NewRoleID: change.role.RoleId,
+			}
+			if change.promotion() {
+				plan.Promotions = append(plan.Promotions, rc)
+			} else {
+				plan.Demotions = append(plan.Demotions, rc)
+			}
+		}
+	}
+
+	return plan, nil
+}
+
+// FormatPlan describes plan in the locale specified by lang, using the names of the members and roles
+// of the guild specified by guildId.
+func FormatPlan(s *discordgo.Session, guildId string, plan *UpdatePlan, lang string) string {
+	var builder strings.Builder
+	builder.WriteString(locale.Get(lang, locale.DryRunSummary,
+		len(plan.Promotions), len(plan.Demotions), plan.Untouched, plan.Missing))
+
+	roleName := func(roleId string) string {
+		if roleId == "" {
+			return locale.Get(lang, locale.EloNone)
+		}
+		if role, err := s.State.Role(guildId, roleId); err == nil {
+			return role.Name
+		}
+		return roleId
+	}
+
+	for _, changes := range [...]struct {
+		key     string
+		changes []RoleChange
+	}{
+		{locale.DryRunPromotion, plan.Promotions},
+		{locale.DryRunDemotion, plan.Demotions},
+	} {
+		for _, rc := range changes.changes {
+			builder.WriteString(locale.Get(lang, changes.key,
+				memberName(s, guildId, rc.UserID), rc.Mode, roleName(rc.OldRoleID), roleName(rc.NewRoleID)))
+		}
+	}
+
+	return builder.String()
+}
+
+// memberName returns the nickname or username of the member specified by userId, or userId if it is not known.
+func memberName(s *discordgo.Session, guildId string, userId string) string {
+	member, err := s.State.Member(guildId, userId)
+	if err != nil || member.User == nil {
+		return userId
+	}
+	if member.Nick != "" {
+		return member.Nick
+	}
+
+	return member.User.Username
+}
+
+func (c *command) planUpdate() {
+	c.send(c.t(locale.UpdatingElo))
+
+	plan, err := PlanGuildElo(c.s, c.m.GuildID)
+	if err != nil {
+		c.send(c.t(locale.EloUpdateFailed))
+		log.Printf("error planning elo update: %v\n", err)
+		return
+	}
+
+	c.replyLong(FormatPlan(c.s, c.m.GuildID, plan, c.lang))
+}
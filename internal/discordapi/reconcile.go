@@ -0,0 +1,308 @@
+package discordapi
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/config"
+	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/db"
+	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/locale"
+	"github.com/bwmarrin/discordgo"
+)
+
+// A ladderChange is a change of the Elo roles of a member on the ladder of a single Elo type.
+type ladderChange struct {
+	// mode is the index of the Elo type in the EloTypes of the config.
+	mode int
+	// currentRoleId is the highest ranked role of the ladder the member has, or an empty string if it has none.
+	currentRoleId       string
+	currentRolePriority int16
+	// role is the role the member should have, which has an empty RoleId if it should have none.
+	role config.EloRole
+	// add is the ID of the role to add, or an empty string if the member already has it or should have none.
+	add string
+	// remove holds the IDs of the roles of the ladder the member has and should not have.
+	remove []string
+}
+
+// promotion reports whether the change gives the member a higher ranked role.
+func (lc ladderChange) promotion() bool {
+	return lc.add != "" && lc.currentRolePriority > lc.role.RolePriority
+}
+
+// A memberChange holds the Elo role changes needed for a single member.
+type memberChange struct {
+	member  *discordgo.Member
+	changes []ladderChange
+}
+
+// ladderChanges returns the Elo role changes needed for member on each ladder of the guild specified by guildId.
+// Every Elo role the member should not have is removed, including duplicates on the same ladder.
+// accs may be empty, in which case all Elo roles are removed.
+func (accs linkedAccounts) ladderChanges(cfg *config.ConfigFile, member *discordgo.Member, guildId string) (changes []ladderChange) {
+	eloTypes := guildEloTypes(cfg, guildId)
+
+	// desired holds the roles the member should have on any ladder,
+	// so that a role shared by several ladders is not removed by one of them.
+	desired := make(map[string]bool)
+	roles := make([]config.EloRole, len(eloTypes))
+	for i, eloType := range eloTypes {
+		if !eloType.Enabled || len(eloType.RoleMap) == 0 {
+			continue
+		}
+		roles[i] = accs.ladderRole(cfg, i, eloType)
+		if roles[i].RoleId != "" {
+			desired[roles[i].RoleId] = true
+		}
+	}
+
+	for i, eloType := range eloTypes {
+		if !eloType.Enabled || len(eloType.RoleMap) == 0 {
+			continue
+		}
+
+		change := ladderChange{mode: i, currentRolePriority: config.InactiveRolePriority, role: roles[i]}
+		var hasRole bool
+		for _, currentRole := range member.Roles {
+			rolePriority, ok := eloType.RoleMap[currentRole]
+			if !ok {
+				continue
+			}
+			if change.currentRoleId == "" || rolePriority < change.currentRolePriority {
+				change.currentRoleId = currentRole
+				change.currentRolePriority = rolePriority
+			}
+			if currentRole == change.role.RoleId {
+				hasRole = true
+			} else if !desired[currentRole] {
+				change.remove = append(change.remove, currentRole)
+			}
+		}
+		if !hasRole {
+			change.add = change.role.RoleId
+		}
+
+		if change.add != "" || len(change.remove) != 0 {
+			changes = append(changes, change)
+		}
+	}
+
+	return
+}
+
+// guildRoleChanges returns the Elo role changes needed for every member of the guild specified by guildId,
+// given the users registered on it. Members that are not registered lose their Elo roles.
+// Registered members missing from the state of s are retrieved with the REST API.
+// It also returns the number of members that need no change, and the number of registered members
+// that could not be found on the guild.
+func guildRoleChanges(cfg *config.ConfigFile, us []db.User, s *discordgo.Session, guildId string) (members []memberChange, untouched int, missing int, err error) {
+	waitForMembers(guildId, memberChunkTimeout)
+
+	guild, err := s.State.Guild(guildId)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("error getting guild %s from state: %w", guildId, err)
+	}
+
+	registered := make(map[string]linkedAccounts)
+	for _, accs := range groupAccounts(us) {
+		registered[accs.discordUserId()] = accs
+	}
+
+	s.State.RLock()
+	guildMembers := append([]*discordgo.Member(nil), guild.Members...)
+	s.State.RUnlock()
+
+	for _, member := range guildMembers {
+		if member.User == nil {
+			continue
+		}
+
+		accs, ok := registered[member.User.ID]
+		if ok {
+			delete(registered, member.User.ID)
+		}
+
+		if changes := accs.ladderChanges(cfg, member, guildId); len(changes) != 0 {
+			members = append(members, memberChange{member: member, changes: changes})
+		} else {
+			untouched++
+		}
+	}
+
+	for userId, accs := range registered {
+		member, err := getMember(s, guildId, userId)
+		if err != nil {
+			log.Println(err)
+			missing++
+			continue
+		}
+
+		if changes := accs.ladderChanges(cfg, member, guildId); len(changes) != 0 {
+			members = append(members, memberChange{member: member, changes: changes})
+		} else {
+			untouched++
+		}
+	}
+
+	return members, untouched, missing, nil
+}
+
+// updateGuildEloRoles brings the Elo roles of every member of the guild specified by guildId
+// in line with the Elo of the users registered on it, applying only the changes needed.
+func updateGuildEloRoles(cfg *config.ConfigFile, us []db.User, s *discordgo.Session, guildId string) error {
+	members, _, missing, err := guildRoleChanges(cfg, us, s, guildId)
+	if err != nil {
+		return err
+	}
+	if missing != 0 {
+		log.Printf("%d registered members of guild %s not found\n", missing, guildId)
+	}
+
+	var errs []string
+	for _, m := range members {
+		if err := applyLadderChanges(cfg, s, guildId, m.member, m.changes); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) != 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+func (accs linkedAccounts) updateMemberEloRoles(cfg *config.ConfigFile, s *discordgo.Session, guildId string) error {
+	member, err := getMember(s, guildId, accs.discordUserId())
+	if err != nil {
+		return err
+	}
+
+	return applyLadderChanges(cfg, s, guildId, member, accs.ladderChanges(cfg, member, guildId))
+}
+
+// removeMemberEloRoles removes all Elo roles from the member specified by userId.
+func removeMemberEloRoles(s *discordgo.Session, guildId string, userId string) error {
+	member, err := getMember(s, guildId, userId)
+	if err != nil {
+		return err
+	}
+
+	cfg := config.Get()
+	return applyLadderChanges(cfg, s, guildId, member, linkedAccounts(nil).ladderChanges(cfg, member, guildId))
+}
+
+// applyLadderChanges applies changes to member and congratulates it on promotions.
+// Changes that could not be applied are retried later.
+func applyLadderChanges(cfg *config.ConfigFile, s *discordgo.Session, guildId string, member *discordgo.Member, changes []ladderChange) error {
+	return applyLadderChangesAttempt(cfg, s, guildId, member, changes, 1)
+}
+
+func applyLadderChangesAttempt(cfg *config.ConfigFile, s *discordgo.Session, guildId string, member *discordgo.Member, changes []ladderChange, attempt int) error {
+	roles, changes := changedRoles(member.Roles, changes)
+	if len(changes) == 0 {
+		return nil
+	}
+
+	if err := editMemberRoles(s, guildId, member.User.ID, roles); err != nil {
+		requeueLadderChanges(s, guildId, member.User.ID, changes, attempt)
+		return fmt.Errorf("error changing elo roles for member %s: %w", member.User.ID, err)
+	}
+
+	for _, change := range changes {
+		for _, roleId := range change.remove {
+			log.Printf("role %s removed from user %s", roleId, member.Mention())
+		}
+		if change.add != "" {
+			log.Printf("role %s added to user %s", change.add, member.Mention())
+		}
+		auditLadderChange(cfg, s, guildId, member.User.ID, change)
+
+		if !change.promotion() {
+			continue
+		}
+
+		// The roles were already changed, so the remaining changes are still logged and announced.
+		roleObj, err := s.State.Role(guildId, change.role.RoleId)
+		if err != nil {
+			log.Printf("error getting role %s from state: %v\n", change.role.RoleId, err)
+			continue
+		}
+
+		s.ChannelMessageSend( //nolint:errcheck
+			cfg.BotChannelId,
+			locale.Get(guildLocale(guildId), locale.Promotion,
+				member.Mention(),
+				roleObj.Name),
+		)
+	}
+
+	return nil
+}
+
+// changedRoles returns memberRoles, the full role list of a member, after applying changes,
+// along with the changes that still have an effect on it.
+func changedRoles(memberRoles []string, changes []ladderChange) (roles []string, effective []ladderChange) {
+	has := make(map[string]bool, len(memberRoles))
+	for _, roleId := range memberRoles {
+		has[roleId] = true
+	}
+
+	remove := make(map[string]bool)
+	for _, change := range changes {
+		effect := change
+		effect.remove = nil
+		for _, roleId := range change.remove {
+			if has[roleId] {
+				effect.remove = append(effect.remove, roleId)
+				remove[roleId] = true
+			}
+		}
+		if has[change.add] {
+			effect.add = ""
+		}
+		if effect.add != "" || len(effect.remove) != 0 {
+			effective = append(effective, effect)
+		}
+	}
+
+	for _, roleId := range memberRoles {
+		if !remove[roleId] {
+			roles = append(roles, roleId)
+		}
+	}
+	for _, change := range effective {
+		if change.add != "" {
+			roles = append(roles, change.add)
+		}
+	}
+
+	return
+}
+
+// auditLadderChange records change in the audit log. The highest ranked current role
+// is recorded as replaced by the added role, and other removed roles are recorded separately.
+func auditLadderChange(cfg *config.ConfigFile, s *discordgo.Session, guildId string, userId string, change ladderChange) {
+	audit := func(oldRoleId string, newRoleId string) {
+		recordAudit(cfg, s, db.AuditEntry{
+			GuildID:  guildId,
+			TargetID: userId,
+			Action:   db.AuditRoleChange,
+			OldValue: oldRoleId,
+			NewValue: newRoleId,
+		})
+	}
+
+	var replaced string
+	for _, roleId := range change.remove {
+		if roleId == change.currentRoleId {
+			replaced = roleId
+		} else {
+			audit(roleId, "")
+		}
+	}
+	if replaced != "" || change.add != "" {
+		audit(replaced, change.add)
+	}
+}
@@ -0,0 +1,76 @@
+package discordapi
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChangedRoles(t *testing.T) {
+	tests := []struct {
+		name        string
+		memberRoles []string
+		changes     []ladderChange
+		roles       []string
+		effective   []ladderChange
+	}{
+		{
+			name:        "replace role",
+			memberRoles: []string{"other", "old"},
+			changes:     []ladderChange{{mode: 0, add: "new", remove: []string{"old"}}},
+			roles:       []string{"other", "new"},
+			effective:   []ladderChange{{mode: 0, add: "new", remove: []string{"old"}}},
+		},
+		{
+			name:      "first role",
+			changes:   []ladderChange{{mode: 0, add: "new"}},
+			roles:     []string{"new"},
+			effective: []ladderChange{{mode: 0, add: "new"}},
+		},
+		{
+			name:        "role already added",
+			memberRoles: []string{"new"},
+			changes:     []ladderChange{{mode: 0, add: "new"}},
+			roles:       []string{"new"},
+		},
+		{
+			name:        "role already removed",
+			memberRoles: []string{"other"},
+			changes:     []ladderChange{{mode: 0, remove: []string{"old"}}},
+			roles:       []string{"other"},
+		},
+		{
+			name:        "partly applied",
+			memberRoles: []string{"new", "old"},
+			changes:     []ladderChange{{mode: 0, add: "new", remove: []string{"old", "older"}}},
+			roles:       []string{"new"},
+			effective:   []ladderChange{{mode: 0, remove: []string{"old"}}},
+		},
+		{
+			name:        "several Elo types",
+			memberRoles: []string{"1v1-old", "2v2-old", "other"},
+			changes: []ladderChange{
+				{mode: 0, add: "1v1-new", remove: []string{"1v1-old"}},
+				{mode: 1, remove: []string{"2v2-old", "2v2-older"}},
+				{mode: 2, add: "3v3-new"},
+			},
+			roles: []string{"other", "1v1-new", "3v3-new"},
+			effective: []ladderChange{
+				{mode: 0, add: "1v1-new", remove: []string{"1v1-old"}},
+				{mode: 1, remove: []string{"2v2-old"}},
+				{mode: 2, add: "3v3-new"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roles, effective := changedRoles(tt.memberRoles, tt.changes)
+			if !reflect.DeepEqual(roles, tt.roles) {
+				t.Errorf("roles = %q, want %q", roles, tt.roles)
+			}
+			if !reflect.DeepEqual(effective, tt.effective) {
+				t.Errorf("effective = %+v, want %+v", effective, tt.effective)
+			}
+		})
+	}
+}
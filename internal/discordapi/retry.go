@@ -0,0 +1,128 @@
+package discordapi
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/config"
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// roleEditAttempts is the number of times a role update is attempted before it is re-queued.
+	roleEditAttempts = 4
+	// roleRetryDelay is the delay before the first retry of role changes that were re-queued,
+	// which doubles for every further retry.
+	roleRetryDelay = time.Minute
+	// roleRetryLimit is the number of times role changes are re-queued before they are left
+	// to the next scheduled update.
+	roleRetryLimit = 3
+)
+
+// roleRetries holds the timers of the role changes re-queued on each session,
+// so that they can be stopped when the session is closed.
+var roleRetries = struct {
+	timers map[*discordgo.Session]map[*time.Timer]bool
+	sync.Mutex
+}{timers: make(map[*discordgo.Session]map[*time.Timer]bool)}
+
+// editMemberRoles replaces the roles of the member specified by userId with roles in a single request,
+// so that the member never ends up with only part of a change. Rate limited requests and server errors
+// are retried with an increasing delay.
+func editMemberRoles(s *discordgo.Session, guildId string, userId string, roles []string) error {
+	if roles == nil {
+		// A nil slice would be encoded as null instead of an empty role list.
+		roles = []string{}
+	}
+
+	delay := time.Second
+	for attempt := 1; ; attempt++ {
+		err := s.GuildMemberEdit(guildId, userId, roles)
+		if err == nil {
+			return nil
+		}
+
+		retryAfter, ok := retryable(err)
+		if !ok || attempt == roleEditAttempts {
+			return err
+		}
+		if retryAfter < delay {
+			retryAfter = delay
+		}
+		time.Sleep(retryAfter)
+		delay *= 2
+	}
+}
+
+// retryable reports whether a request that failed with err may succeed if retried,
+// along with the delay requested by Discord, if any.
+func retryable(err error) (retryAfter time.Duration, ok bool) {
+	var rateLimitErr *discordgo.RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		if rateLimitErr.RateLimit != nil && rateLimitErr.TooManyRequests != nil {
+			retryAfter = rateLimitErr.RetryAfter
+		}
+		return retryAfter, true
+	}
+
+	var restErr *discordgo.RESTError
+	if errors.As(err, &restErr) && restErr.Response != nil {
+		code := restErr.Response.StatusCode
+		return 0, code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+	}
+
+	return 0, false
+}
+
+// requeueLadderChanges schedules changes, which failed on the given attempt, to be applied again
+// to the member specified by userId. The changes are applied to the roles the member has at that time,
+// with the config current at that time.
+func requeueLadderChanges(s *discordgo.Session, guildId string, userId string, changes []ladderChange, attempt int) {
+	if attempt > roleRetryLimit {
+		log.Printf("giving up on elo role changes for member %s on guild %s until the next update\n", userId, guildId)
+		return
+	}
+
+	// The lock is held until the timer is stored, so that it cannot fire before.
+	roleRetries.Lock()
+	defer roleRetries.Unlock()
+
+	var timer *time.Timer
+	timer = time.AfterFunc(roleRetryDelay<<(attempt-1), func() {
+		roleRetries.Lock()
+		pending := roleRetries.timers[s][timer]
+		delete(roleRetries.timers[s], timer)
+		roleRetries.Unlock()
+		if !pending {
+			return
+		}
+
+		member, err := getMember(s, guildId, userId)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		if err := applyLadderChangesAttempt(config.Get(), s, guildId, member, changes, attempt+1); err != nil {
+			log.Println(err)
+		}
+	})
+
+	if roleRetries.timers[s] == nil {
+		roleRetries.timers[s] = make(map[*time.Timer]bool)
+	}
+	roleRetries.timers[s][timer] = true
+}
+
+// CancelRoleRetries stops the role changes re-queued on s, which are left to the next update.
+// It should be called before s is closed.
+func CancelRoleRetries(s *discordgo.Session) {
+	roleRetries.Lock()
+	for timer := range roleRetries.timers[s] {
+		timer.Stop()
+	}
+	delete(roleRetries.timers, s)
+	roleRetries.Unlock()
+}
@@ -0,0 +1,78 @@
+package discordapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestRetryable(t *testing.T) {
+	restError := func(code int) error {
+		return &discordgo.RESTError{Response: &http.Response{StatusCode: code}}
+	}
+
+	tests := []struct {
+		name       string
+		err        error
+		retryAfter time.Duration
+		ok         bool
+	}{
+		{
+			name: "rate limit",
+			err: &discordgo.RateLimitError{RateLimit: &discordgo.RateLimit{
+				TooManyRequests: &discordgo.TooManyRequests{RetryAfter: 3 * time.Second},
+			}},
+			retryAfter: 3 * time.Second,
+			ok:         true,
+		},
+		{
+			name: "wrapped rate limit",
+			err:  fmt.Errorf("error editing member: %w", &discordgo.RateLimitError{RateLimit: &discordgo.RateLimit{}}),
+			ok:   true,
+		},
+		{
+			name: "rate limit without details",
+			err:  &discordgo.RateLimitError{},
+			ok:   true,
+		},
+		{
+			name: "too many requests",
+			err:  restError(http.StatusTooManyRequests),
+			ok:   true,
+		},
+		{
+			name: "server error",
+			err:  restError(http.StatusBadGateway),
+			ok:   true,
+		},
+		{
+			name: "forbidden",
+			err:  restError(http.StatusForbidden),
+		},
+		{
+			name: "not found",
+			err:  fmt.Errorf("error editing member: %w", restError(http.StatusNotFound)),
+		},
+		{
+			name: "no response",
+			err:  &discordgo.RESTError{},
+		},
+		{
+			name: "other error",
+			err:  errors.New("connection reset"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			retryAfter, ok := retryable(tt.err)
+			if retryAfter != tt.retryAfter || ok != tt.ok {
+				t.Errorf("retryable() = %v, %v, want %v, %v", retryAfter, ok, tt.retryAfter, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package discordapi
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/config"
+	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/db"
+	"github.com/bwmarrin/discordgo"
+)
+
+// guildEloTypesCache holds the Elo types of each guild, along with the config they were built from
+// and when they were built.
+var guildEloTypesCache = struct {
+	eloTypes map[string][]config.EloType
+	cfgs     map[string]*config.ConfigFile
+	builtAt  map[string]time.Time
+	sync.RWMutex
+}{
+	eloTypes: make(map[string][]config.EloType),
+	cfgs:     make(map[string]*config.ConfigFile),
+	builtAt:  make(map[string]time.Time),
+}
+
+// roleSyncSlots limits how many guilds sync their Elo roles at once, as each sync holds a database
+// connection and many guilds are created together when the bot connects.
+var roleSyncSlots = make(chan struct{}, 2)
+
+// GuildCreate is the handler for Discordgo GuildCreate events.
+// It requests the members of the guild that were not sent with it and creates any missing Elo roles on the guild.
+func GuildCreate(s *discordgo.Session, g *discordgo.GuildCreate) {
+	requestGuildMembers(s, g.Guild)
+
+	if !hasManagedRoles(config.Get()) {
+		return
+	}
+
+	go func() {
+		if _, _, err := SyncGuildRoles(s, g.ID); err != nil {
+			log.Printf("error syncing elo roles on guild %s: %v\n", g.ID, err)
+		}
+	}()
+}
+
+// guildEloTypes returns cfg.EloTypes with the IDs of the roles created by the bot
+// on the guild specified by guildId filled in.
+func guildEloTypes(cfg *config.ConfigFile, guildId string) []config.EloType {
+	guildEloTypesCache.RLock()
+	eloTypes, ok := guildEloTypesCache.eloTypes[guildId]
+	ok = ok && guildEloTypesCache.cfgs[guildId] == cfg && time.Since(guildEloTypesCache.builtAt[guildId]) < guildCacheTTL
+	guildEloTypesCache.RUnlock()
+	if ok {
+		return eloTypes
+	}
+
+	if !hasManagedRoles(cfg) {
+		return cfg.EloTypes
+	}
+
+	roleIds, err := db.GetGuildRoles(guildId)
+	if err != nil {
+		log.Printf("error getting elo roles for guild %s: %v\n", guildId, err)
+		return cfg.EloTypes
+	}
+
+	eloTypes = make([]config.EloType, len(cfg.EloTypes))
+	for i, eloType := range cfg.EloTypes {
+		eloType.Roles = append([]config.EloRole(nil), eloType.Roles...)
+		for j, role := range eloType.Roles {
+			if role.RoleId == "" && role.Name != "" {
+				eloType.Roles[j].RoleId = roleIds[db.GuildRoleKey{Mode: db.Modes[i], Name: role.Name}]
+			}
+		}
+		eloType.BuildRoleMap()
+		eloTypes[i] = eloType
+	}
+
+	// Elo types built from a config that has since been reloaded are not cached.
+	if cfg == config.Get() {
+		guildEloTypesCache.Lock()
+		guildEloTypesCache.eloTypes[guildId] = eloTypes
+		guildEloTypesCache.cfgs[guildId] = cfg
+		guildEloTypesCache.builtAt[guildId] = time.Now()
+		guildEloTypesCache.Unlock()
+	}
+
+	return eloTypes
+}
+
+func invalidateGuildEloTypes(guildId string) {
+	guildEloTypesCache.Lock()
+	delete(guildEloTypesCache.eloTypes, guildId)
+	delete(guildEloTypesCache.cfgs, guildId)
+	delete(guildEloTypesCache.builtAt, guildId)
+	guildEloTypesCache.Unlock()
+}
+
+// hasManagedRoles reports whether any enabled Elo type of cfg has roles that are created by the bot.
+func hasManagedRoles(cfg *config.ConfigFile) bool {
+	for _, eloType := range cfg.EloTypes {
+		if !eloType.Enabled {
+			continue
+		}
+		for _, role := range eloType.Roles {
+			if role.RoleId == "" && role.Name != "" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// SyncGuildRoles creates the Elo roles without a configured role ID that are missing on the guild specified
+// by guildId, updates the names and colors of existing ones, and orders each ladder by role priority.
+// Syncs of the same guild are serialized across instances, so that roles are only created once.
+// It returns the number of roles created and updated.
+func SyncGuildRoles(s *discordgo.Session, guildId string) (created int, updated int, err error) {
+	roleSyncSlots <- struct{}{}
+	defer func() { <-roleSyncSlots }()
+
+	lock, err := db.LockGuildRoles(context.Background(), guildId)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer lock.Unlock()
+
+	roleIds, err := lock.Roles()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer invalidateGuildEloTypes(guildId)
+
+	// Roles created by another instance may not have reached the state yet.
+	var guildRoles []*discordgo.Role
+	findRole := func(roleId string) (*discordgo.Role, error) {
+		if role, err := s.State.Role(guildId, roleId); err == nil {
+			return role, nil
+		}
+		if guildRoles == nil {
+			roles, err := s.GuildRoles(guildId)
+			if err != nil {
+				return nil, fmt.Errorf("error getting roles of guild %s: %w", guildId, err)
+			}
+			guildRoles = roles
+		}
+		for _, role := range guildRoles {
+			if role.ID == roleId {
+				return role, nil
+			}
+		}
+
+		return nil, nil
+	}
+
+	for i, eloType := range config.Get().EloTypes {
+		if !eloType.Enabled {
+			continue
+		}
+
+		var ladderRoles []*discordgo.Role
+		var ladderPriorities []int16
+		for _, role := range eloType.Roles {
+			if role.RoleId != "" || role.Name == "" {
+				continue
+			}
+
+			key := db.GuildRoleKey{Mode: db.Modes[i], Name: role.Name}
+			var guildRole *discordgo.Role
+			if roleId, ok := roleIds[key]; ok {
+				if guildRole, err = findRole(roleId); err != nil {
+					return created, updated, err
+				}
+			}
+
+			switch {
+			case guildRole == nil:
+				if guildRole, err = s.GuildRoleCreate(guildId); err != nil {
+					return created, updated, fmt.Errorf("error creating role %s: %w", role.Name, err)
+				}
+				roleId := guildRole.ID
+				if guildRole, err = s.GuildRoleEdit(guildId, roleId, role.Name, role.ColorValue(), false, 0, false); err != nil {
+					// Leave no unnamed role behind, as the next sync creates a new one.
+					if err := s.GuildRoleDelete(guildId, roleId); err != nil {
+						log.Printf("error deleting unnamed role %s on guild %s: %v\n", roleId, guildId, err)
+					}
+					return created, updated, fmt.Errorf("error editing role %s: %w", role.Name, err)
+				}
+				if err := lock.SetRole(key, guildRole.ID); err != nil {
+					return created, updated, err
+				}
+				log.Printf("role %s created on guild %s", role.Name, guildId)
+				created++
+
+			case guildRole.Name != role.Name || guildRole.Color != role.ColorValue():
+				if guildRole, err = s.GuildRoleEdit(guildId, guildRole.ID, role.Name, role.ColorValue(),
+					guildRole.Hoist, guildRole.Permissions, guildRole.Mentionable); err != nil {
+					return created, updated, fmt.Errorf("error editing role %s: %w", role.Name, err)
+				}
+				log.Printf("role %s updated on guild %s", role.Name, guildId)
+				updated++
+			}
+
+			ladderRoles = append(ladderRoles, guildRole)
+			ladderPriorities = append(ladderPriorities, role.RolePriority)
+		}
+
+		if err := orderLadderRoles(s, guildId, ladderRoles, ladderPriorities); err != nil {
+			return created, updated, err
+		}
+	}
+
+	return created, updated, nil
+}
+
+// orderLadderRoles reorders roles, whose priorities are given by priorities, so that roles with a lower
+// priority value are higher in the role hierarchy. The roles keep the positions they occupy as a group.
+func orderLadderRoles(s *discordgo.Session, guildId string, roles []*discordgo.Role, priorities []int16) error {
+	changed := ladderRolePositions(roles, priorities)
+	if len(changed) == 0 {
+		return nil
+	}
+
+	if _, err := s.GuildRoleReorder(guildId, changed); err != nil {
+		return fmt.Errorf("error reordering roles: %w", err)
+	}
+	log.Printf("%d elo roles reordered on guild %s", len(changed), guildId)
+
+	return nil
+}
+
+// ladderRolePositions returns the roles whose position changes when roles are ordered by priorities,
+// with their new positions.
+func ladderRolePositions(roles []*discordgo.Role, priorities []int16) []*discordgo.Role {
+	if len(roles) < 2 {
+		return nil
+	}
+
+	positions := make([]int, len(roles))
+	for i, role := range roles {
+		positions[i] = role.Position
+	}
+	sort.Ints(positions)
+	for i := 1; i < len(positions); i++ {
+		if positions[i] <= positions[i-1] {
+			positions[i] = positions[i-1] + 1
+		}
+	}
+
+	order := make([]int, len(roles))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return priorities[order[a]] > priorities[order[b]]
+	})
+
+	var changed []*discordgo.Role
+	for i, idx := range order {
+		if roles[idx].Position != positions[i] {
+			changed = append(changed, &discordgo.Role{ID: roles[idx].ID, Position: positions[i]})
+		}
+	}
+
+	return changed
+}
@@ -0,0 +1,71 @@
+package discordapi
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestLadderRolePositions(t *testing.T) {
+	tests := []struct {
+		name       string
+		positions  map[string]int
+		priorities map[string]int16
+		want       map[string]int
+	}{
+		{
+			name:       "single role",
+			positions:  map[string]int{"a": 3},
+			priorities: map[string]int16{"a": 10},
+		},
+		{
+			name:       "already ordered",
+			positions:  map[string]int{"a": 5, "b": 3},
+			priorities: map[string]int16{"a": 10, "b": 20},
+		},
+		{
+			name:       "reversed",
+			positions:  map[string]int{"a": 3, "b": 5},
+			priorities: map[string]int16{"a": 10, "b": 20},
+			want:       map[string]int{"a": 5, "b": 3},
+		},
+		{
+			name:       "keeps the positions of the group",
+			positions:  map[string]int{"a": 2, "b": 7, "c": 9},
+			priorities: map[string]int16{"a": 10, "b": 20, "c": 30},
+			want:       map[string]int{"a": 9, "c": 2},
+		},
+		{
+			name:       "shared positions",
+			positions:  map[string]int{"a": 4, "b": 4, "c": 4},
+			priorities: map[string]int16{"a": 10, "b": 20, "c": 30},
+			want:       map[string]int{"a": 6, "b": 5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var roles []*discordgo.Role
+			var priorities []int16
+			for _, id := range [...]string{"a", "b", "c"} {
+				if position, ok := tt.positions[id]; ok {
+					roles = append(roles, &discordgo.Role{ID: id, Position: position})
+					priorities = append(priorities, tt.priorities[id])
+				}
+			}
+
+			var got map[string]int
+			for _, role := range ladderRolePositions(roles, priorities) {
+				if got == nil {
+					got = make(map[string]int)
+				}
+				got[role.ID] = role.Position
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ladderRolePositions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package discordapi
+
+import (
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// LoadGuildState adds the guild specified by guildId, along with its roles and members, to the state of s
+// using the REST API. It allows a session that is not connected to the gateway to update Elo roles.
+func LoadGuildState(s *discordgo.Session, guildId string) error {
+	guild, err := s.Guild(guildId)
+	if err != nil {
+		return fmt.Errorf("error getting guild %s: %w", guildId, err)
+	}
+	if err := s.State.GuildAdd(guild); err != nil {
+		return fmt.Errorf("error adding guild %s to state: %w", guildId, err)
+	}
+
+	var after string
+	for {
+		members, err := s.GuildMembers(guildId, after, 1000)
+		if err != nil {
+			return fmt.Errorf("error getting members of guild %s: %w", guildId, err)
+		}
+		for _, member := range members {
+			member.GuildID = guildId
+			if err := s.State.MemberAdd(member); err != nil {
+				return fmt.Errorf("error adding member %s to state: %w", member.User.ID, err)
+			}
+		}
+
+		if len(members) < 1000 {
+			return nil
+		}
+		after = members[len(members)-1].User.ID
+	}
+}
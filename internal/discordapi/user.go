@@ -4,57 +4,178 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/alexisgeoffrey/aoe4api"
 	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/config"
 	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/db"
+	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/locale"
 	"github.com/bwmarrin/discordgo"
 )
 
 type user db.User
 
+// linkedAccounts holds all AOE4 accounts linked by a single Discord member, primary account first.
+type linkedAccounts []db.User
+
 // UpdateGuildElo retrieves and updates all Elo roles on the server specified by the guildId parameter.
 func UpdateGuildElo(s *discordgo.Session, guildId string) error {
+	return UpdateElo(s, []string{guildId})
+}
+
+// UpdateElo retrieves Elo for all users on the servers specified by the guildIds parameter and updates their
+// Elo roles. Elo is retrieved only once for each AOE4 account, regardless of how many servers it is tracked on.
+func UpdateElo(s *discordgo.Session, guildIds []string) error {
+	guilds := make(map[string]*discordgo.Session, len(guildIds))
+	for _, guildId := range guildIds {
+		guilds[guildId] = s
+	}
+
+	return UpdateShardedElo(guilds)
+}
+
+// UpdateShardedElo is like UpdateElo for servers connected through several sessions, such as one for each shard.
+// guilds maps the ID of each server to the session it is connected through.
+func UpdateShardedElo(guilds map[string]*discordgo.Session) error {
 	log.Println("Updating Elo...")
 
-	users, err := db.GetUsers(guildId)
+	guildIds := make([]string, 0, len(guilds))
+	for guildId := range guilds {
+		guildIds = append(guildIds, guildId)
+	}
+	sort.Strings(guildIds)
+
+	cfg := config.Get()
+	guildUsers, err := fetchGuildElo(cfg, guildIds, false)
 	if err != nil {
-		return fmt.Errorf("error getting users: %w", err)
+		return err
+	}
+
+	var errs []string
+	for _, guildId := range guildIds {
+		if err := updateGuildEloRoles(cfg, guildUsers[guildId], guilds[guildId], guildId); err != nil {
+			errs = append(errs, fmt.Sprintf("error updating elo roles on guild %s: %v", guildId, err))
+		}
+	}
+	if len(errs) != 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// fetchGuildElo retrieves Elo for all users on the servers specified by guildIds, once for each AOE4 account,
+// and returns the users of each server. The retrieved Elo is stored unless dryRun is true.
+func fetchGuildElo(cfg *config.ConfigFile, guildIds []string, dryRun bool) (map[string][]db.User, error) {
+	guildUsers := make(map[string][]db.User, len(guildIds))
+	players := make(map[string]*user)
+	for _, guildId := range guildIds {
+		users, err := db.GetUsers(guildId)
+		if err != nil {
+			return nil, fmt.Errorf("error getting users for guild %s: %w", guildId, err)
+		}
+		guildUsers[guildId] = users
+
+		for i := range users {
+			if _, ok := players[users[i].Aoe4Id]; !ok {
+				players[users[i].Aoe4Id] = (*user)(&users[i])
+			}
+		}
 	}
 
 	var wg sync.WaitGroup
-	for i := range users {
+	for _, u := range players {
 		wg.Add(1)
-		go func(i int) {
+		go func(u *user) {
 			defer wg.Done()
-			user := (*user)(&users[i])
-			if err := user.updateMemberElo(s, guildId); err != nil {
+			var err error
+			if dryRun {
+				err = u.fetchMemberElo(cfg, fetchScheduled)
+			} else {
+				err = u.updateMemberElo(cfg, fetchScheduled)
+			}
+			if err != nil {
 				log.Println(err)
 			}
-		}(i)
+		}(u)
 	}
 	wg.Wait()
 
-	if err := updateGuildEloRoles(users, s, guildId); err != nil {
-		return fmt.Errorf("error updating elo roles: %w", err)
+	for _, users := range guildUsers {
+		for i := range users {
+			p := players[users[i].Aoe4Id]
+			users[i].NewElo, users[i].Status, users[i].League, users[i].Stats = p.NewElo, p.Status, p.League, p.Stats
+		}
+	}
+
+	return guildUsers, nil
+}
+
+// UpdateMemberElo retrieves Elo for all accounts linked by the member specified by userId
+// and updates their Elo roles on the guild specified by guildId.
+func UpdateMemberElo(s *discordgo.Session, guildId string, userId string) error {
+	if _, err := db.GetGuildVisibility(userId, guildId); err != nil {
+		return fmt.Errorf("error getting member %s on guild %s: %w", userId, guildId, err)
+	}
+
+	users, err := db.GetUser(userId)
+	if err != nil {
+		return fmt.Errorf("error getting accounts for member %s: %w", userId, err)
+	}
+
+	cfg := config.Get()
+	accs := linkedAccounts(users)
+	for i := range accs {
+		if err := (*user)(&accs[i]).updateMemberElo(cfg, fetchInteractive); err != nil {
+			return err
+		}
+	}
+
+	return accs.updateMemberEloRoles(cfg, s, guildId)
+}
+
+// A fetchKind tells how ratings are retrieved, depending on what asked for them.
+type fetchKind int
+
+const (
+	// fetchInteractive reuses cached ratings, and records errors without counting them as failed runs.
+	fetchInteractive fetchKind = iota
+	// fetchForced always queries the leaderboard, and records errors without counting them as failed runs.
+	fetchForced
+	// fetchScheduled reuses cached ratings, and counts errors as failed runs of guild updates.
+	fetchScheduled
+)
+
+// updateMemberElo retrieves the Elo of u for all enabled Elo types of cfg as specified by kind and stores it.
+func (u *user) updateMemberElo(cfg *config.ConfigFile, kind fetchKind) error {
+	if err := u.fetchMemberElo(cfg, kind); err != nil {
+		return err
+	}
+
+	if err := db.UpdateUserElo(cfg, (*db.User)(u)); err != nil {
+		return fmt.Errorf("error updating user in db: %w", err)
 	}
 
 	return nil
 }
 
-func (u *user) updateMemberElo(s *discordgo.Session, guildId string) (err error) {
+// fetchMemberElo retrieves the Elo of u for all enabled Elo types of cfg as specified by kind, keeping
+// the current value and recording the error for each Elo type that could not be retrieved.
+func (u *user) fetchMemberElo(cfg *config.ConfigFile, kind fetchKind) (err error) {
 	eloAndTs := []struct {
 		newElo     *int16
 		currentElo int16
+		status     *db.RatingStatus
 		teamSize   aoe4api.TeamSize
 	}{
-		{&u.NewElo.OneVOne, u.CurrentElo.OneVOne, aoe4api.OneVOne},
-		{&u.NewElo.TwoVTwo, u.CurrentElo.TwoVTwo, aoe4api.TwoVTwo},
-		{&u.NewElo.ThreeVThree, u.CurrentElo.ThreeVThree, aoe4api.ThreeVThree},
-		{&u.NewElo.FourVFour, u.CurrentElo.FourVFour, aoe4api.FourVFour},
-		{&u.NewElo.Custom, u.CurrentElo.Custom, ""},
+		{&u.NewElo.OneVOne, u.CurrentElo.OneVOne, &u.Status[0], aoe4api.OneVOne},
+		{&u.NewElo.TwoVTwo, u.CurrentElo.TwoVTwo, &u.Status[1], aoe4api.TwoVTwo},
+		{&u.NewElo.ThreeVThree, u.CurrentElo.ThreeVThree, &u.Status[2], aoe4api.ThreeVThree},
+		{&u.NewElo.FourVFour, u.CurrentElo.FourVFour, &u.Status[3], aoe4api.FourVFour},
+		{&u.NewElo.Custom, u.CurrentElo.Custom, &u.Status[4], ""},
 	}
 
 	builder := aoe4api.NewRequestBuilder().
@@ -62,7 +183,7 @@ func (u *user) updateMemberElo(s *discordgo.Session, guildId string) (err error)
 		SetSearchPlayer(u.Aoe4Username)
 
 	var wg sync.WaitGroup
-	for i, t := range config.Cfg.EloTypes {
+	for i, t := range cfg.EloTypes {
 		if !t.Enabled {
 			continue
 		}
@@ -84,152 +205,319 @@ func (u *user) updateMemberElo(s *discordgo.Session, guildId string) (err error)
 		wg.Add(1)
 		go func(i int) {
 			defer wg.Done()
-			memberElo, err := req.QueryElo(u.Aoe4Id)
+			stats, league, err := cachedQueryElo(req, ratingKey{aoeId: u.Aoe4Id, mode: i}, cfg.RatingCacheTTL, kind == fetchForced)
 			if err != nil {
 				*eloAndTs[i].newElo = eloAndTs[i].currentElo
-				// log.Printf("no response from api for %s for elo %s", u.Aoe4Username, [...]string{"1v1", "2v2", "3v3", "4v4", "Custom"}[i])
+				eloAndTs[i].status.LastError = err.Error()
+				if kind == fetchScheduled {
+					eloAndTs[i].status.Failures++
+				}
 				return
 			}
 
-			*eloAndTs[i].newElo = int16(memberElo)
+			// The leaderboard does not report when a player last played, so it is inferred from
+			// changes in the number of games played since the previous successful retrieval.
+			stats.LastPlayed = u.Stats[i].LastPlayed
+			if !eloAndTs[i].status.FetchedAt.IsZero() && stats.Games() != u.Stats[i].Games() {
+				stats.LastPlayed = time.Now()
+			}
+			u.Stats[i] = stats
+
+			*eloAndTs[i].newElo = stats.Rating
+			u.League[i] = league
+			changedAt := eloAndTs[i].status.ChangedAt
+			if changedAt.IsZero() || *eloAndTs[i].newElo != eloAndTs[i].currentElo {
+				changedAt = time.Now()
+			}
+			*eloAndTs[i].status = db.RatingStatus{FetchedAt: time.Now(), ChangedAt: changedAt}
 		}(i)
 	}
 	wg.Wait()
 
-	if err := db.UpdateUserElo(u.DiscordUserID, guildId, u.NewElo); err != nil {
-		return fmt.Errorf("error updating user in db: %w", err)
+	return
+}
+
+// queryElo queries the AOE4 API and returns the statistics and reported league of the player specified by aoeId.
+// The LastPlayed time of the returned statistics is not set.
+func queryElo(req aoe4api.Request, aoeId string) (stats db.PlayerStats, league string, err error) {
+	players, err := req.Query()
+	if err != nil {
+		return db.PlayerStats{}, "", err
 	}
 
-	return
+	for _, player := range players {
+		if strings.Contains(player.UserID, aoeId) {
+			return db.PlayerStats{
+				Rating:    int16(player.Elo),
+				Rank:      player.Rank,
+				Wins:      player.Wins,
+				Losses:    player.Losses,
+				WinRate:   player.WinPercent,
+				WinStreak: player.WinStreak,
+			}, player.RankLevel, nil
+		}
+	}
+
+	return db.PlayerStats{}, "", fmt.Errorf("no Elo value found for player %s", aoeId)
 }
 
-func updateGuildEloRoles(us []db.User, s *discordgo.Session, guildId string) error {
-	for _, u := range us {
-		user := user(u)
-		if err := user.updateMemberEloRoles(s, guildId); errors.Is(err, discordgo.ErrStateNotFound) {
-			log.Println(err)
+// failures returns the number of consecutive runs in which none of the ratings of u enabled in cfg could be
+// retrieved, along with the last error for one of those ratings.
+func (u *user) failures(cfg *config.ConfigFile) (failures int, lastError string) {
+	failures = -1
+	for i, t := range cfg.EloTypes {
+		if !t.Enabled {
 			continue
-		} else if err != nil {
-			return fmt.Errorf("error getting member elo: %w", err)
 		}
+		if failures == -1 || u.Status[i].Failures < failures {
+			failures = u.Status[i].Failures
+		}
+		if u.Status[i].LastError != "" {
+			lastError = u.Status[i].LastError
+		}
+	}
+	if failures == -1 {
+		failures = 0
 	}
 
-	return nil
+	return
 }
 
-func (u *user) updateMemberEloRoles(s *discordgo.Session, guildId string) error {
-	member, err := s.State.Member(guildId, u.DiscordUserID)
-	if err != nil {
-		return fmt.Errorf("error getting member %s from state: %w", u.DiscordUserID, err)
+// groupAccounts groups us, which must be sorted by Discord user ID, by Discord member.
+func groupAccounts(us []db.User) (members []linkedAccounts) {
+	for i := 0; i < len(us); {
+		j := i + 1
+		for j < len(us) && us[j].DiscordUserID == us[i].DiscordUserID {
+			j++
+		}
+		members = append(members, linkedAccounts(us[i:j]))
+		i = j
 	}
 
-	highestElo := u.getHighestElo()
+	return
+}
+
+func (accs linkedAccounts) discordUserId() string {
+	return accs[0].DiscordUserID
+}
 
-eloTypeLoop:
-	for _, eloType := range config.Cfg.EloTypes {
-		var currentRoleId string
-		var currentRolePriority int16 = 9999
-		for _, currentRole := range member.Roles {
-			if rolePriority, ok := eloType.RoleMap[currentRole]; ok {
-				currentRoleId = currentRole
-				currentRolePriority = rolePriority
-				break
-			}
+// roleAccounts returns the accounts used to assign roles to the member, according to the RoleAccountRule of cfg.
+func (accs linkedAccounts) roleAccounts(cfg *config.ConfigFile) linkedAccounts {
+	if cfg.RoleAccountRule != config.RoleAccountRulePrimary {
+		return accs
+	}
+
+	for i := range accs {
+		if accs[i].IsPrimary {
+			return accs[i : i+1]
 		}
+	}
 
-		for _, role := range eloType.Roles {
-			if highestElo >= role.StartingElo && highestElo <= role.EndingElo {
-				if currentRoleId == role.RoleId {
-					break eloTypeLoop
-				}
-				if err := changeMemberEloRole(s, member, currentRoleId, role.RoleId); err != nil {
-					return fmt.Errorf("error changing member elo role from %s to %s for member %s: %w", currentRoleId, role.RoleId, u.DiscordUserID, err)
-				}
-				roleObj, err := s.State.Role(guildId, role.RoleId)
-				if err != nil {
-					return fmt.Errorf("error getting role %s from state: %w", role.RoleId, err)
-				}
+	return accs[:1]
+}
 
-				if currentRolePriority > role.RolePriority {
-					s.ChannelMessageSend( //nolint:errcheck
-						config.Cfg.BotChannelId,
-						fmt.Sprintf("Congrats %s, you are now in %s!",
-							member.Mention(),
-							roleObj.Name),
-					)
-				}
-				break eloTypeLoop
-			}
+// roleElo returns the Elo value of the Elo type at index i of cfg.EloTypes
+// used to assign roles to the member.
+func (accs linkedAccounts) roleElo(cfg *config.ConfigFile, i int) (elo int16) {
+	for _, u := range accs.roleAccounts(cfg) {
+		if newElo := u.NewElo.Values()[i]; newElo > elo {
+			elo = newElo
 		}
+	}
 
-		if err := changeMemberEloRole(s, member, currentRoleId, ""); err != nil {
-			return fmt.Errorf("error removing member elo role from %s: %w", currentRoleId, err)
+	return
+}
+
+// lastActive returns the last time any of the accounts used to assign roles to the member played
+// or had its Elo value change for the Elo type at index i of cfg.EloTypes. A game that leaves the
+// Elo value unchanged still counts as activity.
+func (accs linkedAccounts) lastActive(cfg *config.ConfigFile, i int) (lastActive time.Time) {
+	for _, u := range accs.roleAccounts(cfg) {
+		if u.Status[i].ChangedAt.After(lastActive) {
+			lastActive = u.Status[i].ChangedAt
+		}
+		if u.Stats[i].LastPlayed.After(lastActive) {
+			lastActive = u.Stats[i].LastPlayed
 		}
-		// TODO
-		break //nolint
 	}
 
-	return nil
+	return
 }
 
-func (u *user) getHighestElo() (highestElo int16) {
-	eloVals := []int16{
-		u.NewElo.OneVOne,
-		u.NewElo.TwoVTwo,
-		u.NewElo.ThreeVThree,
-		u.NewElo.FourVFour,
-		u.NewElo.Custom,
+// ladderRole returns the role the member should have on the ladder of the Elo type at index i
+// of cfg.EloTypes, or an EloRole with an empty RoleId if the member should have no role.
+func (accs linkedAccounts) ladderRole(cfg *config.ConfigFile, i int, eloType config.EloType) config.EloRole {
+	elo := accs.roleElo(cfg, i)
+	if elo == 0 {
+		return config.EloRole{}
 	}
 
-	for _, elo := range eloVals {
-		if elo > highestElo {
-			highestElo = elo
+	if eloType.InactiveAfter > 0 && time.Since(accs.lastActive(cfg, i)) > eloType.InactiveAfter {
+		return config.EloRole{
+			RoleId:       eloType.InactiveRoleId,
+			RolePriority: config.InactiveRolePriority,
 		}
 	}
 
-	return
-}
+	if eloType.UseReportedLeague {
+		if league := accs.roleLeague(cfg, i); league != "" {
+			for _, role := range eloType.Roles {
+				if config.LeagueKey(role.Name) == config.LeagueKey(league) {
+					return role
+				}
+			}
+		}
+	}
 
-func changeMemberEloRole(s *discordgo.Session, m *discordgo.Member, currentRoleId string, newRoleId string) error {
-	if currentRoleId != "" {
-		if err := s.GuildMemberRoleRemove(m.GuildID, m.User.ID, currentRoleId); err != nil {
-			return fmt.Errorf("error removing role: %w", err)
+	for _, role := range eloType.Roles {
+		if elo >= role.StartingElo && elo <= role.EndingElo {
+			return role
 		}
-		log.Printf("role %s removed from user %s", currentRoleId, m.Mention())
 	}
 
-	if newRoleId != "" {
-		if err := s.GuildMemberRoleAdd(m.GuildID, m.User.ID, newRoleId); err != nil {
-			return fmt.Errorf("error adding role: %w", err)
+	return config.EloRole{}
+}
+
+// roleLeague returns the league reported for the account with the highest Elo value
+// of the Elo type at index i of cfg.EloTypes among the accounts used to assign roles.
+func (accs linkedAccounts) roleLeague(cfg *config.ConfigFile, i int) (league string) {
+	var elo int16
+	for _, u := range accs.roleAccounts(cfg) {
+		if newElo := u.NewElo.Values()[i]; newElo > elo {
+			elo = newElo
+			league = u.League[i]
 		}
-		log.Printf("role %s added to user %s", newRoleId, m.Mention())
 	}
 
-	return nil
+	return
 }
 
-func (u *user) EloString(name string) string {
+// EloString returns the Elo values of all linked accounts for all Elo types enabled in cfg,
+// labeled in the locale specified by lang, along with their changes since baselines,
+// which are keyed by AOE4 ID and may be nil.
+func (accs linkedAccounts) EloString(cfg *config.ConfigFile, name string, lang string, baselines map[string][len(db.Modes)]db.RatingBaselines) string {
 	var builder strings.Builder
 
 	builder.WriteString(fmt.Sprintf("%s:\n", name))
 
-	eloVals := []int16{
-		u.NewElo.OneVOne,
-		u.NewElo.TwoVTwo,
-		u.NewElo.ThreeVThree,
-		u.NewElo.FourVFour,
-		u.NewElo.Custom,
+	for i := range accs {
+		if len(accs) > 1 {
+			if accs[i].IsPrimary {
+				builder.WriteString(locale.Get(lang, locale.PrimaryAccountHeader, accs[i].Aoe4Username))
+			} else {
+				builder.WriteString(locale.Get(lang, locale.AccountHeader, accs[i].Aoe4Username))
+			}
+		}
+		builder.WriteString((*user)(&accs[i]).eloString(cfg, lang, baselines[accs[i].Aoe4Id]))
 	}
 
-	for i, label := range [...]string{"1v1", "2v2", "3v3", "4v4", "Custom"} {
-		if config.Cfg.EloTypes[i].Enabled {
-			if eloVals[i] == 0 {
-				builder.WriteString(fmt.Sprintf("%s: None\n", label))
+	return builder.String()
+}
+
+func (u *user) eloString(cfg *config.ConfigFile, lang string, baselines [len(db.Modes)]db.RatingBaselines) string {
+	var builder strings.Builder
+
+	eloVals := u.NewElo.Values()
+
+	for i, label := range modeLabels(lang) {
+		if !cfg.EloTypes[i].Enabled {
+			continue
+		}
+		if eloVals[i] == 0 {
+			builder.WriteString(fmt.Sprintf("%s: %s\n", label, locale.Get(lang, locale.EloNone)))
+			continue
+		}
+
+		if status := u.Status[i]; status.Stale(cfg.StaleAfter) {
+			if status.FetchedAt.IsZero() {
+				builder.WriteString(fmt.Sprintf("%s: %d %s\n", label, eloVals[i],
+					locale.Get(lang, locale.EloNeverFetched)))
 			} else {
-				builder.WriteString(fmt.Sprintf("%s: %d\n", label, eloVals[i]))
+				builder.WriteString(fmt.Sprintf("%s: %d %s\n", label, eloVals[i],
+					locale.Get(lang, locale.EloStale, status.FetchedAt.Format("2006-01-02"))))
+			}
+		} else {
+			builder.WriteString(fmt.Sprintf("%s: %d\n", label, eloVals[i]))
+		}
+
+		if stats := u.Stats[i]; stats.Games() > 0 {
+			builder.WriteString("  ")
+			// The leaderboard reports no rank for some players.
+			if stats.Rank > 0 {
+				builder.WriteString(locale.Get(lang, locale.EloRank, stats.Rank))
+			}
+			builder.WriteString(locale.Get(lang, locale.EloStats,
+				stats.Wins, stats.Losses, stats.WinRate, stats.WinStreak))
+			if !stats.LastPlayed.IsZero() {
+				builder.WriteString(locale.Get(lang, locale.EloLastPlayed, stats.LastPlayed.Format("2006-01-02")))
 			}
+			builder.WriteString("\n")
+		}
+
+		if deltas := deltaString(lang, eloVals[i], baselines[i]); deltas != "" {
+			builder.WriteString(locale.Get(lang, locale.EloDeltas, deltas) + "\n")
 		}
 	}
 
 	return builder.String()
 }
+
+// modeLabels returns the labels of the Elo types in the locale specified by lang, in the same order as db.Modes.
+func modeLabels(lang string) [len(db.Modes)]string {
+	return [...]string{"1v1", "2v2", "3v3", "4v4", locale.Get(lang, locale.EloCustom)}
+}
+
+// deltaString returns the changes of the Elo value elo since each known baseline, in the locale specified by lang,
+// or an empty string if no baseline is known.
+func deltaString(lang string, elo int16, baselines db.RatingBaselines) string {
+	var deltas []string
+	for _, baseline := range [...]struct {
+		key   string
+		value int16
+	}{
+		{locale.EloDeltaPrevious, baselines.Previous},
+		{locale.EloDeltaWeek, baselines.WeekStart},
+		{locale.EloDeltaRoleChange, baselines.RoleChange},
+	} {
+		if baseline.value != 0 {
+			deltas = append(deltas, locale.Get(lang, baseline.key, int(elo)-int(baseline.value)))
+		}
+	}
+
+	return strings.Join(deltas, ", ")
+}
+
+// ratingBaselines returns the rating baselines of each of accs, keyed by AOE4 ID, using the Elo role changes
+// of the member on the guild specified by guildId.
+func (accs linkedAccounts) ratingBaselines(cfg *config.ConfigFile, guildId string) (map[string][len(db.Modes)]db.RatingBaselines, error) {
+	roleChanged, err := db.GetRoleChanges(guildId, accs.discordUserId())
+	if err != nil {
+		return nil, err
+	}
+
+	var roleChanges [len(db.Modes)]time.Time
+	for i, eloType := range guildEloTypes(cfg, guildId) {
+		for roleId := range eloType.RoleMap {
+			if changedAt := roleChanged[roleId]; changedAt.After(roleChanges[i]) {
+				roleChanges[i] = changedAt
+			}
+		}
+	}
+
+	baselines := make(map[string][len(db.Modes)]db.RatingBaselines, len(accs))
+	weekStart := weekStart(time.Now())
+	for _, u := range accs {
+		if baselines[u.Aoe4Id], err = db.GetRatingBaselines(u.Aoe4Id, weekStart, roleChanges); err != nil {
+			return nil, err
+		}
+	}
+
+	return baselines, nil
+}
+
+// weekStart returns the start of the week of t, which is Monday at midnight UTC.
+func weekStart(t time.Time) time.Time {
+	t = t.UTC()
+	days := (int(t.Weekday()) + 6) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-days, 0, 0, 0, 0, time.UTC)
+}
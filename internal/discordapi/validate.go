@@ -0,0 +1,119 @@
+package discordapi
+
+import (
+	"fmt"
+
+	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/config"
+	"github.com/bwmarrin/discordgo"
+)
+
+// ValidateGuild checks the config against the guild specified by guildId, reporting roles and channels
+// that do not exist and missing bot permissions. It only uses the REST API, so s does not need to be open.
+func ValidateGuild(s *discordgo.Session, guildId string) ([]config.Problem, error) {
+	cfg := config.Get()
+	var problems []config.Problem
+	errorf := func(path string, format string, args ...interface{}) {
+		problems = append(problems, config.Problem{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	roles, err := s.GuildRoles(guildId)
+	if err != nil {
+		return nil, fmt.Errorf("error getting roles for guild %s: %w", guildId, err)
+	}
+	guildRoles := make(map[string]*discordgo.Role, len(roles))
+	for _, role := range roles {
+		guildRoles[role.ID] = role
+	}
+
+	botUser, err := s.User("@me")
+	if err != nil {
+		return nil, fmt.Errorf("error getting bot user: %w", err)
+	}
+	botMember, err := s.GuildMember(guildId, botUser.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting bot member on guild %s: %w", guildId, err)
+	}
+
+	// The @everyone role has the same ID as the guild.
+	var permissions int64
+	if everyone, ok := guildRoles[guildId]; ok {
+		permissions = everyone.Permissions
+	}
+	var botPosition int
+	for _, roleId := range botMember.Roles {
+		if role, ok := guildRoles[roleId]; ok {
+			permissions |= role.Permissions
+			if role.Position > botPosition {
+				botPosition = role.Position
+			}
+		}
+	}
+	admin := permissions&discordgo.PermissionAdministrator != 0
+	if !admin && permissions&discordgo.PermissionManageRoles == 0 {
+		errorf("", "the bot does not have the Manage Roles permission")
+	}
+
+	checkRole := func(path string, roleId string) {
+		role, ok := guildRoles[roleId]
+		switch {
+		case !ok:
+			errorf(path, "role %s does not exist on guild %s", roleId, guildId)
+		case role.Position >= botPosition:
+			errorf(path, "role %s (%s) is not below the highest role of the bot, so the bot cannot assign it", role.Name, roleId)
+		}
+	}
+
+	for i, eloType := range guildEloTypes(cfg, guildId) {
+		if !eloType.Enabled {
+			continue
+		}
+
+		path := config.EloTypeKeys[i]
+		for j, role := range eloType.Roles {
+			rolePath := fmt.Sprintf("%s.roles[%d]", path, j)
+			if eloType.Preset != "" {
+				rolePath = fmt.Sprintf("%s.preset(%s)", path, role.Name)
+			}
+			switch {
+			case role.RoleId != "":
+				checkRole(rolePath+".role_id", role.RoleId)
+			case role.Name != "":
+				problems = append(problems, config.Problem{
+					Path:    rolePath + ".name",
+					Message: fmt.Sprintf("role %q has not been created on guild %s yet", role.Name, guildId),
+					Warning: true,
+				})
+			}
+		}
+		if eloType.InactiveRoleId != "" {
+			checkRole(path+".inactive_role_id", eloType.InactiveRoleId)
+		}
+	}
+
+	for i, roleId := range cfg.AdminRoles {
+		if _, ok := guildRoles[roleId]; !ok {
+			errorf(fmt.Sprintf("admin_roles[%d]", i), "role %s does not exist on guild %s", roleId, guildId)
+		}
+	}
+
+	channel, err := s.Channel(cfg.BotChannelId)
+	if err != nil {
+		errorf("bot_channel_id", "channel %s could not be found: %v", cfg.BotChannelId, err)
+		return problems, nil
+	}
+	if channel.GuildID != guildId {
+		errorf("bot_channel_id", "channel %s is not on guild %s", channel.ID, guildId)
+		return problems, nil
+	}
+
+	//nolint:staticcheck // UserChannelPermissions falls back to the REST API, which is needed without the state.
+	channelPermissions, err := s.UserChannelPermissions(botUser.ID, channel.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting bot permissions in channel %s: %w", channel.ID, err)
+	}
+	if channelPermissions&discordgo.PermissionSendMessages == 0 {
+		errorf("bot_channel_id", "the bot cannot send messages in channel #%s", channel.Name)
+	}
+
+	return problems, nil
+}
@@ -0,0 +1,189 @@
+// Package export encodes and decodes registrations for backups and migrations between deployments.
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/db"
+)
+
+// Supported formats.
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+)
+
+// csvColumns holds the CSV header, which is followed by one Elo column for each mode in db.Modes.
+var csvColumns = []string{"discord_id", "guild_id", "visible", "aoe_id", "username", "is_primary"}
+
+// IsFormat reports whether format is a supported format.
+func IsFormat(format string) bool {
+	return format == FormatJSON || format == FormatCSV
+}
+
+// FormatFromName returns the format matching the extension of the file name, or FormatJSON if it has none.
+func FormatFromName(name string) string {
+	if strings.EqualFold(filepath.Ext(name), ".csv") {
+		return FormatCSV
+	}
+
+	return FormatJSON
+}
+
+// Write encodes regs to w in the format specified by format.
+func Write(w io.Writer, regs []db.Registration, format string) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(regs)
+	case FormatCSV:
+		return writeCSV(w, regs)
+	default:
+		return fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+// Read decodes registrations from r in the format specified by format.
+func Read(r io.Reader, format string) ([]db.Registration, error) {
+	switch format {
+	case FormatJSON:
+		var regs []db.Registration
+		if err := json.NewDecoder(r).Decode(&regs); err != nil {
+			return nil, fmt.Errorf("error decoding json: %w", err)
+		}
+		return regs, nil
+	case FormatCSV:
+		return readCSV(r)
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+func writeCSV(w io.Writer, regs []db.Registration) error {
+	cw := csv.NewWriter(w)
+
+	header := append([]string(nil), csvColumns...)
+	for _, mode := range db.Modes {
+		header = append(header, "elo_"+mode)
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	for _, r := range regs {
+		record := []string{
+			r.DiscordID,
+			r.GuildID,
+			strconv.FormatBool(r.Visible),
+			r.AoeID,
+			r.Username,
+			strconv.FormatBool(r.IsPrimary),
+		}
+		for _, mode := range db.Modes {
+			if elo, ok := r.Ratings[mode]; ok {
+				record = append(record, strconv.Itoa(int(elo)))
+			} else {
+				record = append(record, "")
+			}
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func readCSV(r io.Reader) ([]db.Registration, error) {
+	cr := csv.NewReader(r)
+
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading csv header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, column := range header {
+		columns[strings.TrimSpace(column)] = i
+	}
+	for _, column := range []string{"discord_id", "aoe_id", "username"} {
+		if _, ok := columns[column]; !ok {
+			return nil, fmt.Errorf("missing csv column %s", column)
+		}
+	}
+
+	var regs []db.Registration
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return regs, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("error reading csv: %w", err)
+		}
+
+		field := func(column string) string {
+			if i, ok := columns[column]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		reg := db.Registration{
+			DiscordID: field("discord_id"),
+			GuildID:   field("guild_id"),
+			AoeID:     field("aoe_id"),
+			Username:  field("username"),
+			Visible:   true,
+		}
+		if value := field("visible"); value != "" {
+			if reg.Visible, err = strconv.ParseBool(value); err != nil {
+				return nil, fmt.Errorf("invalid visible on line %d: %w", line, err)
+			}
+		}
+		if value := field("is_primary"); value != "" {
+			if reg.IsPrimary, err = strconv.ParseBool(value); err != nil {
+				return nil, fmt.Errorf("invalid is_primary on line %d: %w", line, err)
+			}
+		}
+		for _, mode := range db.Modes {
+			value := field("elo_" + mode)
+			if value == "" {
+				continue
+			}
+			elo, err := strconv.ParseInt(value, 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("invalid elo_%s on line %d: %w", mode, line, err)
+			}
+			if reg.Ratings == nil {
+				reg.Ratings = make(map[string]int16, len(db.Modes))
+			}
+			reg.Ratings[mode] = int16(elo)
+		}
+
+		regs = append(regs, reg)
+	}
+}
+
+// FilterGuild returns the registrations in regs for the guild specified by guildId,
+// along with the number of registrations left out.
+func FilterGuild(regs []db.Registration, guildId string) (filtered []db.Registration, removed int) {
+	for _, r := range regs {
+		if r.GuildID == guildId {
+			filtered = append(filtered, r)
+		} else {
+			removed++
+		}
+	}
+
+	return
+}
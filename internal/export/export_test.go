@@ -0,0 +1,162 @@
+package export
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alexisgeoffrey/aoe4elobot/v2/internal/db"
+)
+
+var testRegistrations = []db.Registration{
+	{
+		DiscordID: "100000000000000001",
+		GuildID:   "100000000000000010",
+		Visible:   true,
+		AoeID:     "1234",
+		Username:  "Player, \"One\"",
+		IsPrimary: true,
+		Ratings:   map[string]int16{"1v1": 1200, "custom": -5},
+	},
+	{
+		DiscordID: "100000000000000001",
+		GuildID:   "100000000000000010",
+		Visible:   true,
+		AoeID:     "5678",
+		Username:  "Smurf",
+	},
+	{
+		DiscordID: "100000000000000002",
+		AoeID:     "9012",
+		Username:  "Hidden",
+		IsPrimary: true,
+		Ratings:   map[string]int16{"2v2": 800, "3v3": 0, "4v4": 32767},
+	},
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		regs []db.Registration
+	}{
+		{"registrations", testRegistrations},
+		{"no registrations", nil},
+	}
+
+	for _, format := range []string{FormatJSON, FormatCSV} {
+		for _, tt := range tests {
+			t.Run(format+"/"+tt.name, func(t *testing.T) {
+				var buf bytes.Buffer
+				if err := Write(&buf, tt.regs, format); err != nil {
+					t.Fatalf("Write() error = %v", err)
+				}
+
+				got, err := Read(&buf, format)
+				if err != nil {
+					t.Fatalf("Read() error = %v", err)
+				}
+				if !reflect.DeepEqual(got, tt.regs) {
+					t.Errorf("Read() = %+v, want %+v", got, tt.regs)
+				}
+			})
+		}
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     string
+		want    []db.Registration
+		wantErr bool
+	}{
+		{
+			name: "defaults for optional columns",
+			csv:  "discord_id,aoe_id,username\n100000000000000001, 1234 ,Player\n",
+			want: []db.Registration{{DiscordID: "100000000000000001", AoeID: "1234", Username: "Player", Visible: true}},
+		},
+		{
+			name: "reordered columns",
+			csv:  "username,elo_1v1,aoe_id,discord_id,visible\nPlayer,1100,1234,100000000000000001,false\n",
+			want: []db.Registration{{
+				DiscordID: "100000000000000001",
+				AoeID:     "1234",
+				Username:  "Player",
+				Ratings:   map[string]int16{"1v1": 1100},
+			}},
+		},
+		{
+			name: "empty file",
+			csv:  "",
+		},
+		{
+			name:    "missing column",
+			csv:     "discord_id,username\n100000000000000001,Player\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid visible",
+			csv:     "discord_id,aoe_id,username,visible\n100000000000000001,1234,Player,maybe\n",
+			wantErr: true,
+		},
+		{
+			name:    "elo out of range",
+			csv:     "discord_id,aoe_id,username,elo_1v1\n100000000000000001,1234,Player,40000\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Read(strings.NewReader(tt.csv), FormatCSV)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Read() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Read() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnsupportedFormat(t *testing.T) {
+	if err := Write(&bytes.Buffer{}, testRegistrations, "xml"); err == nil {
+		t.Error("Write() error = nil, want error")
+	}
+	if _, err := Read(strings.NewReader(""), "xml"); err == nil {
+		t.Error("Read() error = nil, want error")
+	}
+}
+
+func TestFormats(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+	}{
+		{"registrations.json", FormatJSON},
+		{"registrations.csv", FormatCSV},
+		{"REGISTRATIONS.CSV", FormatCSV},
+		{"registrations", FormatJSON},
+		{"registrations.txt", FormatJSON},
+	}
+
+	for _, tt := range tests {
+		if got := FormatFromName(tt.name); got != tt.format {
+			t.Errorf("FormatFromName(%q) = %q, want %q", tt.name, got, tt.format)
+		}
+	}
+
+	for format, want := range map[string]bool{FormatJSON: true, FormatCSV: true, "xml": false, "": false} {
+		if got := IsFormat(format); got != want {
+			t.Errorf("IsFormat(%q) = %v, want %v", format, got, want)
+		}
+	}
+}
+
+func TestFilterGuild(t *testing.T) {
+	filtered, removed := FilterGuild(testRegistrations, "100000000000000010")
+	if len(filtered) != 2 || removed != 1 {
+		t.Errorf("FilterGuild() = %d registrations, %d removed, want 2, 1", len(filtered), removed)
+	}
+}
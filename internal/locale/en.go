@@ -0,0 +1,108 @@
+package locale
+
+var en = map[string]string{
+	Usage: "Usage:\n```\n" +
+		"%[1]ssetEloInfo [@User] SteamUsername/XboxLiveUsername, STEAMID64/XboxLiveID\nAliases: %[1]sset, %[1]slink\n\n" +
+		"%[1]sunlink [@User] STEAMID64/XboxLiveID\n\n" +
+		"%[1]sprimary [@User] STEAMID64/XboxLiveID\n\n" +
+		"%[1]soptin\n%[1]soptout\n%[1]svisibility public/private\n\n" +
+		"%[1]supdateElo [--dry-run] (admin)\nAliases: %[1]supdate, %[1]su\n\n" +
+		"%[1]seloInfo [@User] [--force]\nAliases: %[1]sinfo, %[1]sstats, %[1]si, %[1]ss\n\n" +
+		"%[1]slanguage [LanguageCode/reset]\nAliases: %[1]slang\n\n" +
+		"%[1]sprefix NewPrefix (admin)\n" +
+		"%[1]smentionPrefix on/off (admin)\n" +
+		"%[1]sserverLanguage LanguageCode (admin)\n" +
+		"%[1]ssyncRoles (admin)\n" +
+		"%[1]sfailing [Runs] (admin)\n" +
+		"%[1]sexport [json/csv] (admin)\n" +
+		"%[1]simport [skip/overwrite] (admin)\n" +
+		"%[1]saudit [@User] (admin)\n" +
+		"%[1]spermissions Command [allow role/permission/user Value | disable | reset] (admin)\n" +
+		"%[1]sdigest [#Channel/off/reset] (admin)\n" +
+		"```\nFind STEAMID64 @ https://steamid.io/lookup",
+	UpdatingElo:                "Updating elo...",
+	EloUpdateFailed:            "Elo failed to update.",
+	EloUpdated:                 "Elo updated!",
+	InfoUpdateFailed:           "Your AOE4 info failed to update.\n",
+	InfoUpdated:                "AOE4 account %[2]s with ID %[3]s has been linked to %[1]s.",
+	AccountUnlinked:            "AOE4 account with ID %[2]s has been unlinked from %[1]s.",
+	PrimaryAccountSet:          "AOE4 account with ID %[2]s is now %[1]s's primary account.",
+	AccountNotFound:            "No linked AOE4 account found with that ID.\n",
+	AccountUpdateFailed:        "Unable to update linked AOE4 accounts.\n",
+	AccountHeader:              "%s:\n",
+	PrimaryAccountHeader:       "%s (primary):\n",
+	OptedIn:                    "You have opted in to Elo tracking on this server with your linked AOE4 accounts.",
+	OptedOut:                   "You have opted out of Elo tracking on this server. Your linked AOE4 accounts are kept for other servers.",
+	NotOptedIn:                 "You have not opted in to Elo tracking on this server. Use `%soptin` to use your linked AOE4 accounts here.\n",
+	VisibilityInvalid:          "Invalid input for visibility.\n",
+	VisibilityPublic:           "Your Elo info is now visible to other members of this server.",
+	VisibilityPrivate:          "Your Elo info is now hidden from other members of this server.",
+	EloInfoFailed:              "Unable to retrieve Elo info.\n",
+	NotRegistered:              "You are not registered.\n",
+	UserNotRegistered:          "User is not registered.\n",
+	InsufficientPrivileges:     "Insufficient privileges for this command.\n",
+	SetOtherUserForbidden:      "Insufficient privileges to set Elo info for another user.\n",
+	CurrentPrefix:              "The current command prefix is `%s`.\n",
+	PrefixUpdated:              "Command prefix has been updated to `%s`.",
+	PrefixUpdateFailed:         "Unable to update command prefix.",
+	MentionPrefixInvalid:       "Invalid input for mention prefix.\n",
+	MentionPrefixEnabled:       "Mention prefix has been enabled.",
+	MentionPrefixDisabled:      "Mention prefix has been disabled.",
+	MentionPrefixFailed:        "Unable to update mention prefix.",
+	CurrentLocale:              "Your current language is `%s`. Available languages: %s",
+	LocaleUpdated:              "Your language has been updated to `%s`.",
+	LocaleReset:                "Your language has been reset to the server default.",
+	LocaleUpdateFailed:         "Unable to update language.",
+	LocaleUnsupported:          "Unsupported language `%s`. Available languages: %s",
+	ServerLocaleUpdated:        "Server language has been updated to `%s`.",
+	Promotion:                  "Congrats %s, you are now in %s!",
+	EloStale:                   "(stale, last updated %s)",
+	EloNeverFetched:            "(stale, never retrieved)",
+	FailingHeader:              "Registrations that failed to update for at least %d consecutive runs:\n",
+	FailingEntry:               "%s: %s (%s), %d failures, last error: %s\n",
+	FailingNone:                "No registrations have failed to update for %d consecutive runs.",
+	RolesSynced:                "Elo roles synced: %d created, %d updated.",
+	RolesSyncFailed:            "Unable to sync all Elo roles (%d created, %d updated). Check that the bot has the Manage Roles permission.",
+	EloNone:                    "None",
+	EloCustom:                  "Custom",
+	ExportFailed:               "Unable to export registrations.\n",
+	ImportNoAttachment:         "Attach a JSON or CSV export file to import.\n",
+	ImportFailed:               "Unable to import registrations: %s",
+	Imported:                   "Imported %d registrations, skipped %d unchanged or without a linked account and ignored %d for other servers.",
+	AuditHeader:                "Audit log:\n",
+	AuditEntry:                 "`%[1]s` %[2]s: %[3]s for %[4]s (%[5]s → %[6]s)\n",
+	AuditNone:                  "No audit entries found.",
+	AuditBot:                   "Bot",
+	CommandDisabled:            "This command is disabled on this server.",
+	PermissionsInvalid:         "Invalid input for permissions.\n",
+	PermissionsUpdateFailed:    "Unable to update command permissions.",
+	PermissionsDefaultAdmin:    "`%s` uses its default permissions: admins only.",
+	PermissionsDefaultEveryone: "`%s` uses its default permissions: everyone.",
+	PermissionsList:            "`%s` can be used by admins and: %s",
+	PermissionsDisabled:        "`%s` is disabled on this server.",
+	DryRunSummary:              "Dry run: %d promotions, %d demotions, %d members unchanged, %d members not found.\n",
+	DryRunPromotion:            "Promote %s (%s): %s → %s\n",
+	DryRunDemotion:             "Demote %s (%s): %s → %s\n",
+	EloStats:                   "%dW/%dL (%.1f%% won), streak %+d",
+	EloLastPlayed:              ", last played %s",
+	EloDeltas:                  "  Change: %s",
+	EloDeltaPrevious:           "last %+d",
+	EloDeltaWeek:               "this week %+d",
+	EloDeltaRoleChange:         "since last role change %+d",
+	DigestHeader:               "**Weekly digest**\n",
+	DigestGainers:              "Top gainers:\n",
+	DigestLosers:               "Top losers:\n",
+	DigestTop:                  "Top %d:\n",
+	DigestRating:               "%d. %s (%s): %d (%+d)\n",
+	DigestTopRating:            "%d. %s (%s): %d\n",
+	DigestNewRoles:             "New roles:\n",
+	DigestNewRole:              "%s: %s\n",
+	DigestNewMembers:           "Newly linked: %s\n",
+	DigestChannelCurrent:       "Weekly digests are posted in %s.",
+	DigestChannelNone:          "Weekly digests are not posted on this server.",
+	DigestChannelOff:           "Weekly digests have been turned off.",
+	DigestChannelInvalid:       "Invalid channel for digests.\n",
+	DigestChannelFailed:        "Unable to update the digest channel.",
+	TargetNotMember:            "That user is not a member of this server.\n",
+	EloRank:                    "Rank #%d, ",
+}
@@ -0,0 +1,108 @@
+package locale
+
+var fr = map[string]string{
+	Usage: "Utilisation :\n```\n" +
+		"%[1]ssetEloInfo [@Utilisateur] PseudoSteam/PseudoXboxLive, STEAMID64/IDXboxLive\nAlias : %[1]sset, %[1]slink\n\n" +
+		"%[1]sunlink [@Utilisateur] STEAMID64/IDXboxLive\n\n" +
+		"%[1]sprimary [@Utilisateur] STEAMID64/IDXboxLive\n\n" +
+		"%[1]soptin\n%[1]soptout\n%[1]svisibility public/private\n\n" +
+		"%[1]supdateElo [--dry-run] (admin)\nAlias : %[1]supdate, %[1]su\n\n" +
+		"%[1]seloInfo [@Utilisateur] [--force]\nAlias : %[1]sinfo, %[1]sstats, %[1]si, %[1]ss\n\n" +
+		"%[1]slanguage [CodeLangue/reset]\nAlias : %[1]slang\n\n" +
+		"%[1]sprefix NouveauPréfixe (admin)\n" +
+		"%[1]smentionPrefix on/off (admin)\n" +
+		"%[1]sserverLanguage CodeLangue (admin)\n" +
+		"%[1]ssyncRoles (admin)\n" +
+		"%[1]sfailing [Exécutions] (admin)\n" +
+		"%[1]sexport [json/csv] (admin)\n" +
+		"%[1]simport [skip/overwrite] (admin)\n" +
+		"%[1]saudit [@Utilisateur] (admin)\n" +
+		"%[1]spermissions Commande [allow role/permission/user Valeur | disable | reset] (admin)\n" +
+		"%[1]sdigest [#Salon/off/reset] (admin)\n" +
+		"```\nTrouvez votre STEAMID64 sur https://steamid.io/lookup",
+	UpdatingElo:                "Mise à jour de l'Elo...",
+	EloUpdateFailed:            "La mise à jour de l'Elo a échoué.",
+	EloUpdated:                 "Elo mis à jour !",
+	InfoUpdateFailed:           "La mise à jour de vos informations AOE4 a échoué.\n",
+	InfoUpdated:                "Le compte AOE4 %[2]s avec l'ID %[3]s a été lié à %[1]s.",
+	AccountUnlinked:            "Le compte AOE4 avec l'ID %[2]s a été délié de %[1]s.",
+	PrimaryAccountSet:          "Le compte AOE4 avec l'ID %[2]s est maintenant le compte principal de %[1]s.",
+	AccountNotFound:            "Aucun compte AOE4 lié avec cet ID.\n",
+	AccountUpdateFailed:        "Impossible de modifier les comptes AOE4 liés.\n",
+	AccountHeader:              "%s :\n",
+	PrimaryAccountHeader:       "%s (principal) :\n",
+	OptedIn:                    "Le suivi Elo est activé sur ce serveur avec vos comptes AOE4 liés.",
+	OptedOut:                   "Le suivi Elo est désactivé sur ce serveur. Vos comptes AOE4 liés sont conservés pour les autres serveurs.",
+	NotOptedIn:                 "Le suivi Elo n'est pas activé pour vous sur ce serveur. Utilisez `%soptin` pour y utiliser vos comptes AOE4 liés.\n",
+	VisibilityInvalid:          "Valeur invalide pour la visibilité.\n",
+	VisibilityPublic:           "Vos informations Elo sont maintenant visibles par les autres membres de ce serveur.",
+	VisibilityPrivate:          "Vos informations Elo sont maintenant cachées aux autres membres de ce serveur.",
+	EloInfoFailed:              "Impossible de récupérer les informations Elo.\n",
+	NotRegistered:              "Vous n'êtes pas inscrit.\n",
+	UserNotRegistered:          "L'utilisateur n'est pas inscrit.\n",
+	InsufficientPrivileges:     "Privilèges insuffisants pour cette commande.\n",
+	SetOtherUserForbidden:      "Privilèges insuffisants pour modifier les informations Elo d'un autre utilisateur.\n",
+	CurrentPrefix:              "Le préfixe de commande actuel est `%s`.\n",
+	PrefixUpdated:              "Le préfixe de commande a été changé en `%s`.",
+	PrefixUpdateFailed:         "Impossible de changer le préfixe de commande.",
+	MentionPrefixInvalid:       "Valeur invalide pour le préfixe par mention.\n",
+	MentionPrefixEnabled:       "Le préfixe par mention a été activé.",
+	MentionPrefixDisabled:      "Le préfixe par mention a été désactivé.",
+	MentionPrefixFailed:        "Impossible de modifier le préfixe par mention.",
+	CurrentLocale:              "Votre langue actuelle est `%s`. Langues disponibles : %s",
+	LocaleUpdated:              "Votre langue a été changée en `%s`.",
+	LocaleReset:                "Votre langue a été réinitialisée à celle du serveur.",
+	LocaleUpdateFailed:         "Impossible de changer la langue.",
+	LocaleUnsupported:          "Langue `%s` non prise en charge. Langues disponibles : %s",
+	ServerLocaleUpdated:        "La langue du serveur a été changée en `%s`.",
+	Promotion:                  "Félicitations %s, vous êtes maintenant %s !",
+	EloStale:                   "(obsolète, mis à jour le %s)",
+	EloNeverFetched:            "(obsolète, jamais récupéré)",
+	FailingHeader:              "Inscriptions en échec de mise à jour depuis au moins %d exécutions consécutives :\n",
+	FailingEntry:               "%s : %s (%s), %d échecs, dernière erreur : %s\n",
+	FailingNone:                "Aucune inscription en échec de mise à jour depuis %d exécutions consécutives.",
+	RolesSynced:                "Rôles Elo synchronisés : %d créés, %d mis à jour.",
+	RolesSyncFailed:            "Impossible de synchroniser tous les rôles Elo (%d créés, %d mis à jour). Vérifiez que le bot a la permission Gérer les rôles.",
+	EloNone:                    "Aucun",
+	EloCustom:                  "Personnalisée",
+	ExportFailed:               "Impossible d'exporter les inscriptions.\n",
+	ImportNoAttachment:         "Joignez un fichier d'export JSON ou CSV à importer.\n",
+	ImportFailed:               "Impossible d'importer les inscriptions : %s",
+	Imported:                   "%d inscriptions importées, %d inchangées ou sans compte lié ignorées et %d d'autres serveurs ignorées.",
+	AuditHeader:                "Journal d'audit :\n",
+	AuditEntry:                 "`%[1]s` %[2]s : %[3]s pour %[4]s (%[5]s → %[6]s)\n",
+	AuditNone:                  "Aucune entrée d'audit trouvée.",
+	AuditBot:                   "Bot",
+	CommandDisabled:            "Cette commande est désactivée sur ce serveur.",
+	PermissionsInvalid:         "Saisie invalide pour les permissions.\n",
+	PermissionsUpdateFailed:    "Impossible de mettre à jour les permissions de la commande.",
+	PermissionsDefaultAdmin:    "`%s` utilise ses permissions par défaut : admins uniquement.",
+	PermissionsDefaultEveryone: "`%s` utilise ses permissions par défaut : tout le monde.",
+	PermissionsList:            "`%s` peut être utilisée par les admins et : %s",
+	PermissionsDisabled:        "`%s` est désactivée sur ce serveur.",
+	DryRunSummary:              "Simulation : %d promotions, %d rétrogradations, %d membres inchangés, %d membres introuvables.\n",
+	DryRunPromotion:            "Promouvoir %s (%s) : %s → %s\n",
+	DryRunDemotion:             "Rétrograder %s (%s) : %s → %s\n",
+	EloStats:                   "%dV/%dD (%.1f %% gagnées), série %+d",
+	EloLastPlayed:              ", dernière partie le %s",
+	EloDeltas:                  "  Évolution : %s",
+	EloDeltaPrevious:           "dernière %+d",
+	EloDeltaWeek:               "cette semaine %+d",
+	EloDeltaRoleChange:         "depuis le dernier changement de rôle %+d",
+	DigestHeader:               "**Résumé de la semaine**\n",
+	DigestGainers:              "Plus fortes progressions :\n",
+	DigestLosers:               "Plus fortes baisses :\n",
+	DigestTop:                  "Top %d :\n",
+	DigestRating:               "%d. %s (%s) : %d (%+d)\n",
+	DigestTopRating:            "%d. %s (%s) : %d\n",
+	DigestNewRoles:             "Nouveaux rôles :\n",
+	DigestNewRole:              "%s : %s\n",
+	DigestNewMembers:           "Nouveaux membres liés : %s\n",
+	DigestChannelCurrent:       "Les résumés de la semaine sont publiés dans %s.",
+	DigestChannelNone:          "Les résumés de la semaine ne sont pas publiés sur ce serveur.",
+	DigestChannelOff:           "Les résumés de la semaine ont été désactivés.",
+	DigestChannelInvalid:       "Salon invalide pour les résumés.\n",
+	DigestChannelFailed:        "Impossible de mettre à jour le salon des résumés.",
+	TargetNotMember:            "Cet utilisateur n'est pas membre de ce serveur.\n",
+	EloRank:                    "Rang n°%d, ",
+}
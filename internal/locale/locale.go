@@ -0,0 +1,127 @@
+// Package locale provides translated versions of all messages sent by the bot.
+package locale
+
+import "fmt"
+
+// DefaultLocale is used for any message that is missing from the requested locale.
+const DefaultLocale = "en"
+
+// Message keys.
+const (
+	Usage                      = "usage"
+	UpdatingElo                = "updating_elo"
+	EloUpdateFailed            = "elo_update_failed"
+	EloUpdated                 = "elo_updated"
+	InfoUpdateFailed           = "info_update_failed"
+	InfoUpdated                = "info_updated"
+	AccountUnlinked            = "account_unlinked"
+	PrimaryAccountSet          = "primary_account_set"
+	AccountNotFound            = "account_not_found"
+	AccountUpdateFailed        = "account_update_failed"
+	AccountHeader              = "account_header"
+	PrimaryAccountHeader       = "primary_account_header"
+	OptedIn                    = "opted_in"
+	OptedOut                   = "opted_out"
+	NotOptedIn                 = "not_opted_in"
+	VisibilityInvalid          = "visibility_invalid"
+	VisibilityPublic           = "visibility_public"
+	VisibilityPrivate          = "visibility_private"
+	EloInfoFailed              = "elo_info_failed"
+	NotRegistered              = "not_registered"
+	UserNotRegistered          = "user_not_registered"
+	InsufficientPrivileges     = "insufficient_privileges"
+	SetOtherUserForbidden      = "set_other_user_forbidden"
+	CurrentPrefix              = "current_prefix"
+	PrefixUpdated              = "prefix_updated"
+	PrefixUpdateFailed         = "prefix_update_failed"
+	MentionPrefixInvalid       = "mention_prefix_invalid"
+	MentionPrefixEnabled       = "mention_prefix_enabled"
+	MentionPrefixDisabled      = "mention_prefix_disabled"
+	MentionPrefixFailed        = "mention_prefix_failed"
+	CurrentLocale              = "current_locale"
+	LocaleUpdated              = "locale_updated"
+	LocaleReset                = "locale_reset"
+	LocaleUpdateFailed         = "locale_update_failed"
+	LocaleUnsupported          = "locale_unsupported"
+	ServerLocaleUpdated        = "server_locale_updated"
+	Promotion                  = "promotion"
+	EloStale                   = "elo_stale"
+	EloNeverFetched            = "elo_never_fetched"
+	FailingHeader              = "failing_header"
+	FailingEntry               = "failing_entry"
+	FailingNone                = "failing_none"
+	RolesSynced                = "roles_synced"
+	RolesSyncFailed            = "roles_sync_failed"
+	EloNone                    = "elo_none"
+	EloCustom                  = "elo_custom"
+	ExportFailed               = "export_failed"
+	ImportNoAttachment         = "import_no_attachment"
+	ImportFailed               = "import_failed"
+	Imported                   = "imported"
+	AuditHeader                = "audit_header"
+	AuditEntry                 = "audit_entry"
+	AuditNone                  = "audit_none"
+	AuditBot                   = "audit_bot"
+	CommandDisabled            = "command_disabled"
+	PermissionsInvalid         = "permissions_invalid"
+	PermissionsUpdateFailed    = "permissions_update_failed"
+	PermissionsDefaultAdmin    = "permissions_default_admin"
+	PermissionsDefaultEveryone = "permissions_default_everyone"
+	PermissionsList            = "permissions_list"
+	PermissionsDisabled        = "permissions_disabled"
+	DryRunSummary              = "dry_run_summary"
+	DryRunPromotion            = "dry_run_promotion"
+	DryRunDemotion             = "dry_run_demotion"
+	EloStats                   = "elo_stats"
+	EloLastPlayed              = "elo_last_played"
+	EloDeltas                  = "elo_deltas"
+	EloDeltaPrevious           = "elo_delta_previous"
+	EloDeltaWeek               = "elo_delta_week"
+	EloDeltaRoleChange         = "elo_delta_role_change"
+	DigestHeader               = "digest_header"
+	DigestGainers              = "digest_gainers"
+	DigestLosers               = "digest_losers"
+	DigestTop                  = "digest_top"
+	DigestRating               = "digest_rating"
+	DigestTopRating            = "digest_top_rating"
+	DigestNewRoles             = "digest_new_roles"
+	DigestNewRole              = "digest_new_role"
+	DigestNewMembers           = "digest_new_members"
+	DigestChannelCurrent       = "digest_channel_current"
+	DigestChannelNone          = "digest_channel_none"
+	DigestChannelOff           = "digest_channel_off"
+	DigestChannelInvalid       = "digest_channel_invalid"
+	DigestChannelFailed        = "digest_channel_failed"
+	TargetNotMember            = "target_not_member"
+	EloRank                    = "elo_rank"
+)
+
+var catalogs = map[string]map[string]string{
+	"en": en,
+	"fr": fr,
+}
+
+// Supported reports whether messages are available for the locale specified by lang.
+func Supported(lang string) bool {
+	_, ok := catalogs[lang]
+	return ok
+}
+
+// Locales returns the codes of all supported locales.
+func Locales() []string {
+	return []string{"en", "fr"}
+}
+
+// Get returns the message specified by key in the locale specified by lang, formatted with args.
+// Messages missing from lang fall back to DefaultLocale.
+func Get(lang string, key string, args ...interface{}) string {
+	msg, ok := catalogs[lang][key]
+	if !ok {
+		msg = catalogs[DefaultLocale][key]
+	}
+
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}